@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	gotoken "go/token"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Abbrev names an expression that would otherwise be repeated throughout the
+// generated assertions
+type Abbrev struct {
+	name string
+	expr Expr
+}
+
+// bindingKind selects how abbreviations are declared in the output
+type bindingKind int
+
+const (
+	// one ghost variable per abbreviation, declared before the assertions
+	ghostBinding bindingKind = iota
+	// a let expression around every assertion that uses an abbreviation
+	letBinding
+)
+
+func parseBindingKind(s string) (bindingKind, error) {
+	switch s {
+	case "ghost":
+		return ghostBinding, nil
+	case "let":
+		return letBinding, nil
+	}
+	return 0, fmt.Errorf("unknown binding %q, expected ghost or let", s)
+}
+
+// parseAbbrev parses an abbreviation of the form name=expr
+func parseAbbrev(s string) (Abbrev, error) {
+	name, src, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !gotoken.IsIdentifier(name) {
+		return Abbrev{}, fmt.Errorf("invalid abbreviation %q, expected name=expr", s)
+	}
+	e, err := parseExpr(src)
+	if err != nil {
+		return Abbrev{}, err
+	}
+	return Abbrev{name, e}, nil
+}
+
+// loadAbbrevs reads a file with one abbreviation name = expr per line. Empty
+// lines and lines starting with // are skipped.
+func loadAbbrevs(path string) ([]Abbrev, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := []Abbrev{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+		a, err := parseAbbrev(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		res = append(res, a)
+	}
+	return res, sc.Err()
+}
+
+// abbreviate replaces every occurrence of an abbreviated expression in e by
+// the name of the abbreviation. Longer expressions are replaced first, so that
+// an abbreviation may contain a shorter one.
+func abbreviate(e Expr, abbrevs []Abbrev) Expr {
+	abbrevs = slices.SortedStableFunc(slices.Values(abbrevs), func(a, b Abbrev) int {
+		return cmp.Compare(len(b.expr.String()), len(a.expr.String()))
+	})
+	for _, a := range abbrevs {
+		e = replaceExpr(e, a.expr.String(), Var{Name: a.name})
+	}
+	return e
+}
+
+func replaceExpr(e Expr, target string, to Var) Expr {
+	return Rewrite(e, func(e Expr) Expr {
+		if sym, ok := e.(SymLit); ok {
+			sym.val.e = replaceExpr(sym.val.e, target, to)
+			e = sym
+		}
+		if e.String() == target {
+			return withPos(to, e.Pos())
+		}
+		return e
+	})
+}
+
+// assertion is a generated assert lhs == rhs, citing the source of lhs
+type assertion struct {
+	lhs, rhs Expr
+}
+
+// uses returns the abbreviations that occur in the given expressions or in
+// the definitions of the abbreviations they use, in the order they were defined
+func uses(abbrevs []Abbrev, exprs ...Expr) []Abbrev {
+	used := map[string]bool{}
+	v := visitor(func(e Expr) {
+		if x, ok := e.(Var); ok {
+			used[x.Name] = true
+		}
+	})
+	for _, e := range exprs {
+		Walk(v, e)
+	}
+	expanded := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, a := range abbrevs {
+			if used[a.name] && !expanded[a.name] {
+				expanded[a.name] = true
+				Walk(v, a.expr)
+				changed = true
+			}
+		}
+	}
+
+	res := []Abbrev{}
+	for _, a := range abbrevs {
+		if used[a.name] {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+type visitor func(e Expr)
+
+func (v visitor) Visit(e Expr) { v(e) }
+
+// minAbbrevLen is the length a repeated subterm must have when printed to be
+// abbreviated automatically
+const minAbbrevLen = 20
+
+// autoAbbrevs binds subterms that occur more than once in the assertions to
+// generated names, largest first. Only subterms without calls are considered,
+// so that every assertion still states what it is about.
+//
+// The abbreviations are returned such that each one is defined after the ones
+// its definition uses.
+func autoAbbrevs(asserts []assertion, taken []Abbrev) ([]assertion, []Abbrev) {
+	names := map[string]bool{}
+	for _, a := range taken {
+		names[a.name] = true
+	}
+	collect := visitor(func(e Expr) {
+		if x, ok := e.(Var); ok {
+			names[x.Name] = true
+		}
+	})
+	for _, a := range asserts {
+		Walk(collect, a.lhs)
+		Walk(collect, a.rhs)
+	}
+
+	res := []Abbrev{}
+	for n := 0; ; {
+		exprs := []Expr{}
+		for _, a := range asserts {
+			exprs = append(exprs, a.lhs, a.rhs)
+		}
+		for _, a := range res {
+			exprs = append(exprs, a.expr)
+		}
+		target, ok := repeatedSubterm(exprs)
+		if !ok {
+			break
+		}
+
+		name := ""
+		for ; name == "" || names[name]; n++ {
+			name = fmt.Sprintf("v%d", n)
+		}
+		names[name] = true
+		to := Var{Name: name}
+
+		key := target.String()
+		for i, a := range asserts {
+			asserts[i] = assertion{replaceExpr(a.lhs, key, to), replaceExpr(a.rhs, key, to)}
+		}
+		for i, a := range res {
+			res[i].expr = replaceExpr(a.expr, key, to)
+		}
+		res = append(res, Abbrev{name, target})
+	}
+
+	return asserts, sortAbbrevs(res)
+}
+
+// repeatedSubterm returns the largest call-free subterm that occurs at least
+// twice in exprs
+func repeatedSubterm(exprs []Expr) (Expr, bool) {
+	count := map[string]int{}
+	first := []Expr{}
+	v := visitor(func(e Expr) {
+		switch e.(type) {
+		case Var, IntLit, BoolLit, Const, SymLit:
+			return
+		}
+		key := e.String()
+		if len(key) < minAbbrevLen || hasCall(e) {
+			return
+		}
+		if count[key] == 0 {
+			first = append(first, e)
+		}
+		count[key]++
+	})
+	for _, e := range exprs {
+		Walk(v, e)
+	}
+
+	var res Expr
+	for _, e := range first {
+		if count[e.String()] > 1 && (res == nil || len(e.String()) > len(res.String())) {
+			res = e
+		}
+	}
+	return res, res != nil
+}
+
+func hasCall(e Expr) bool {
+	found := false
+	Walk(visitor(func(e Expr) {
+		if _, ok := e.(Call); ok {
+			found = true
+		}
+	}), e)
+	return found
+}
+
+// sortAbbrevs orders abbrevs such that every abbreviation comes after the ones
+// it uses
+func sortAbbrevs(abbrevs []Abbrev) []Abbrev {
+	res := []Abbrev{}
+	done := map[string]bool{}
+	var visit func(a Abbrev)
+	visit = func(a Abbrev) {
+		if done[a.name] {
+			return
+		}
+		done[a.name] = true
+		for _, dep := range uses(abbrevs, a.expr) {
+			visit(dep)
+		}
+		res = append(res, a)
+	}
+	for _, a := range abbrevs {
+		visit(a)
+	}
+	return res
+}
+
+// writeAssertions prints the assertions, declaring the abbreviations they
+// use as configured by the options
+func writeAssertions(w io.Writer, asserts []assertion, opts options) {
+	abbrevs := opts.abbrevs
+	for i, a := range asserts {
+		asserts[i] = assertion{abbreviate(a.lhs, abbrevs), abbreviate(a.rhs, abbrevs)}
+	}
+	if opts.autoAbbrev {
+		var generated []Abbrev
+		asserts, generated = autoAbbrevs(asserts, abbrevs)
+		abbrevs = append(slices.Clip(abbrevs), generated...)
+	}
+
+	if opts.bind == ghostBinding {
+		all := []Expr{}
+		for _, a := range asserts {
+			all = append(all, a.lhs, a.rhs)
+		}
+		for _, a := range uses(abbrevs, all...) {
+			fmt.Fprintf(w, "ghost %s := %v\n", a.name, a.expr)
+		}
+	}
+
+	for _, a := range asserts {
+		fmt.Fprint(w, "assert ")
+		if opts.bind == letBinding {
+			for _, abbrev := range uses(abbrevs, a.lhs, a.rhs) {
+				fmt.Fprintf(w, "let %s := %v in ", abbrev.name, abbrev.expr)
+			}
+		}
+		fmt.Fprintf(w, "%v == %v", a.lhs, a.rhs)
+		if pos := a.lhs.Pos(); pos.IsValid() {
+			fmt.Fprintf(w, " // %v", pos)
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// markerTag starts the annotation of a marker comment such as
+//
+//	// @ interp: ToPath(p)
+//
+// The generated assertions are written below the marker and closed by a
+// "// @ interp: end" comment, which tells reruns what to replace.
+const markerTag = "interp:"
+
+const markerEnd = "end"
+
+// marker returns the expression of a marker comment line, "end" for the line
+// closing a generated block, and false for all other lines
+func marker(line string) (string, bool) {
+	comment := strings.TrimSpace(line)
+	start, end, ok := annotation(comment)
+	if !ok || !strings.HasPrefix(comment, "//") {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(strings.TrimSpace(comment[start:end]), markerTag)
+	return strings.TrimSpace(rest), ok
+}
+
+// annotateSources rewrites the marker comments of the given files and of the
+// source files in the given directories
+func annotateSources(cmd *command, c Ctx, paths []string, opts options) int {
+	code := 0
+	for _, path := range paths {
+		names := []string{path}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			if names, err = sourceFiles(path); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				code = 1
+				continue
+			}
+		}
+		for _, name := range names {
+			if !annotateFile(cmd, c, name, opts) {
+				code = 1
+			}
+		}
+	}
+	return code
+}
+
+// annotateFile writes the assertions generated by cmd below every marker of
+// the file, replacing the blocks written by earlier runs. It reports whether
+// all markers could be evaluated.
+//
+// In .go files the assertions are written as // @ annotations.
+func annotateFile(cmd *command, c Ctx, path string, opts options) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	lines := strings.SplitAfter(string(src), "\n")
+	prefix := ""
+	if filepath.Ext(path) == ".go" {
+		prefix = "// @ "
+	}
+
+	ok := true
+	out := strings.Builder{}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		out.WriteString(line)
+		input, isMarker := marker(line)
+		if !isMarker || input == markerEnd {
+			continue
+		}
+
+		// the block of an earlier run ends before the next marker
+		old := i
+		for j := i + 1; j < len(lines); j++ {
+			next, isMarker := marker(lines[j])
+			if isMarker {
+				if next == markerEnd {
+					old = j
+				}
+				break
+			}
+		}
+
+		block, err := markerBlock(cmd, c, input, path, i+1, opts)
+		if err != nil {
+			// most errors cite the marker already
+			msg := err.Error()
+			if at := fmt.Sprintf("%s:%d:", path, i+1); !strings.HasPrefix(msg, at) {
+				msg = at + " " + msg
+			}
+			fmt.Fprintln(os.Stderr, msg)
+			ok = false
+			continue
+		}
+		i = old
+
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !strings.HasSuffix(line, "\n") {
+			out.WriteString("\n")
+		}
+		for _, l := range strings.SplitAfter(block, "\n") {
+			if l != "" {
+				out.WriteString(indent + prefix + l)
+			}
+		}
+		out.WriteString(indent + "// @ " + markerTag + " " + markerEnd + "\n")
+	}
+
+	if err := os.WriteFile(path, []byte(out.String()), info.Mode()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	return ok
+}
+
+// markerBlock returns the assertions cmd generates for the expression input
+// of the marker on the given line of path. Abbreviations are bound with let, so that the blocks of several
+// markers in one function do not clash.
+func markerBlock(cmd *command, c Ctx, input string, path string, line int, opts options) (string, error) {
+	e, err := parseExprAt(input, path, line)
+	if err != nil {
+		return "", err
+	}
+	r, err := runExpr(cmd, c, c.resolveInput(e), opts)
+	if err != nil {
+		return "", err
+	}
+	opts.bind = letBinding
+	w := strings.Builder{}
+	writeAssertions(&w, r.asserts, opts)
+	return w.String(), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const methodSrc = `package main
+
+type T struct {
+	x int
+}
+
+ghost
+decreases
+pure func double(n int) int {
+	return n + n
+}
+
+requires acc(&t.x)
+func (t *T) Get() int {
+	// @ interp: double(2)
+	return t.x
+}
+`
+
+func TestAnnotateMethod(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "method.gobra")
+	if err := os.WriteFile(path, []byte(methodSrc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Loader{}.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := options{filter: filter{maxDepth: -1, maxArgSize: -1}}
+	if !annotateFile(findCommand("annotate"), c, path, opts) {
+		t.Fatal("annotate failed")
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\t// @ interp: double(2)\n" +
+		"\tassert double(2) == 4 // " + path + ":15:1\n" +
+		"\t// @ interp: end\n" +
+		"\treturn t.x\n"
+	if !strings.Contains(string(src), want) {
+		t.Errorf("got\n%s\nwant the marker block\n%s", src, want)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	gotypes "go/types"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/antlr4-go/antlr/v4"
+)
+
+// loadGoFile extracts the Gobra annotations of a Go file. Ghost declarations
+// live in `//@` and `/*@ @*/` comments, while Go functions become visible if
+// their documentation marks them as pure.
+//
+// Everything that is not part of an annotation, the package clause, an import
+// or a pure function is replaced by spaces, so that the remaining text can be
+// parsed as a .gobra file with all positions unchanged. Pure functions that
+// cannot be translated are skipped with a warning.
+func loadGoFile(path string) (*File, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, path, src, goparser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	blank := func() []byte {
+		out := make([]byte, len(src))
+		for i, c := range src {
+			if c == '\n' {
+				out[i] = c
+			} else {
+				out[i] = ' '
+			}
+		}
+		return out
+	}
+	offset := func(pos gotoken.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	keep := func(out []byte, from, to gotoken.Pos) {
+		copy(out[offset(from):offset(to)], src[offset(from):offset(to)])
+	}
+	keepAnnotations := func(out []byte, group *ast.CommentGroup) {
+		// marker comments and the assertions generated below them are
+		// not part of the specification
+		generated := false
+		for _, c := range group.List {
+			if input, isMarker := marker(c.Text); isMarker {
+				generated = input != markerEnd
+				continue
+			}
+			if generated {
+				continue
+			}
+			if start, end, ok := annotation(c.Text); ok {
+				at := offset(c.Pos())
+				copy(out[at+start:at+end], c.Text[start:end])
+			}
+		}
+	}
+
+	out := blank()
+	keep(out, f.Package, f.Name.End())
+
+	type span struct{ from, to int }
+	decls := []span{}
+	docs := map[*ast.CommentGroup]bool{}
+	goImports := []span{}
+
+	for _, decl := range f.Decls {
+		decls = append(decls, span{offset(decl.Pos()), offset(decl.End())})
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			docs[d.Doc] = true
+			if d.Tok == gotoken.IMPORT {
+				keep(out, d.Pos(), d.End())
+				goImports = append(goImports, span{fset.Position(d.Pos()).Line, fset.Position(d.End()).Line})
+			}
+		case *ast.FuncDecl:
+			docs[d.Doc] = true
+			if d.Recv == nil && d.Doc != nil && isPure(d.Doc) {
+				fn := blank()
+				keep(fn, f.Package, f.Name.End())
+				keepAnnotations(fn, d.Doc)
+				keep(fn, d.Pos(), d.End())
+				if err := checkGoFunc(d, fn, path); err != nil {
+					fmt.Fprintf(os.Stderr, "%v: skipping pure function %s: %v\n", fset.Position(d.Pos()), d.Name.Name, err)
+					continue
+				}
+				keepAnnotations(out, d.Doc)
+				keep(out, d.Pos(), d.End())
+			}
+		}
+	}
+
+	for _, group := range f.Comments {
+		at := offset(group.Pos())
+		inDecl := slices.ContainsFunc(decls, func(s span) bool {
+			return s.from <= at && at < s.to
+		})
+		if !inDecl && !docs[group] {
+			keepAnnotations(out, group)
+		}
+	}
+
+	res, err := parseFile(antlr.NewInputStream(string(out)), path)
+	if err != nil {
+		return nil, err
+	}
+	for i, imp := range res.imports {
+		res.imports[i].optional = slices.ContainsFunc(goImports, func(s span) bool {
+			return s.from <= imp.pos.line && imp.pos.line <= s.to
+		})
+	}
+	return res, nil
+}
+
+// checkGoFunc reports why the pure Go function d, whose text alone is in src,
+// cannot be translated: a parameter or result type without a Gobra
+// counterpart, or code the parser does not accept
+func checkGoFunc(d *ast.FuncDecl, src []byte, path string) error {
+	for _, list := range []*ast.FieldList{d.Type.Params, d.Type.Results} {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			if !translatable(field.Type) {
+				return fmt.Errorf("type %s is not supported", gotypes.ExprString(field.Type))
+			}
+		}
+	}
+	_, err := parseFile(antlr.NewInputStream(string(src)), path)
+	return err
+}
+
+// translatable reports whether a Go type denotes the same type in Gobra. Of
+// the predeclared types, only int, bool and byte are supported.
+func translatable(t ast.Expr) bool {
+	switch t := t.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "int", "bool", "byte", "uint8":
+			return true
+		}
+		return gotypes.Universe.Lookup(t.Name) == nil
+	case *ast.SelectorExpr:
+		return true
+	case *ast.ParenExpr:
+		return translatable(t.X)
+	}
+	return false
+}
+
+// annotation returns the range of the Gobra code within the text of a
+// comment, if the comment is an annotation
+func annotation(comment string) (int, int, bool) {
+	if rest, ok := strings.CutPrefix(comment, "//"); ok {
+		trimmed := strings.TrimLeft(rest, " \t")
+		if !strings.HasPrefix(trimmed, "@") {
+			return 0, 0, false
+		}
+		return len(comment) - len(trimmed) + 1, len(comment), true
+	}
+
+	if strings.HasPrefix(comment, "/*@") && strings.HasSuffix(comment, "@*/") && len(comment) >= 6 {
+		return 3, len(comment) - 3, true
+	}
+	return 0, 0, false
+}
+
+func isPure(doc *ast.CommentGroup) bool {
+	for _, c := range doc.List {
+		start, end, ok := annotation(c.Text)
+		if ok && slices.Contains(strings.Fields(c.Text[start:end]), "pure") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadBatch reads the input expressions of a batch file. Each line holds one
+// expression, usually a call. A line [name] starts a table of arguments for
+// the function name, in which every line holds the comma-separated arguments
+// of one call; an empty header [] ends the table. Empty lines and lines
+// starting with // are skipped.
+//
+// Lines that cannot be parsed are reported in errs without stopping at them.
+func loadBatch(path string) (exprs []Expr, errs []error, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	table := ""
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+		if name, ok := strings.CutPrefix(text, "["); ok {
+			name, ok = strings.CutSuffix(name, "]")
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s:%d: unterminated table header %s", path, line, text))
+				continue
+			}
+			table = strings.TrimSpace(name)
+			continue
+		}
+
+		src := text
+		if table != "" {
+			src = fmt.Sprintf("%s(%s)", table, text)
+		}
+		e, err := parseExprAt(src, path, line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		exprs = append(exprs, e)
+	}
+	return exprs, errs, sc.Err()
+}
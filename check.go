@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"slices"
+)
+
+type typeChecker struct {
+	c    *Ctx
+	errs []error
+}
+
+func (t *typeChecker) Visit(expr Expr) {
+	switch e := expr.(type) {
+	case StructLit:
+		if _, ok := t.c.types[e.typ]; !ok {
+			return
+		}
+		st, ok := t.c.structType(TAbstract{e.typ})
+		if !ok {
+			t.errorf(e.pos, "%s is not a struct type", e.typ)
+			return
+		}
+		for _, name := range slices.Sorted(maps.Keys(e.fields)) {
+			typ, ok := st.field(name)
+			if !ok {
+				t.errorf(e.pos, "struct %q does not have field %q", e.typ, name)
+				continue
+			}
+			if got := e.fields[name].Type(t.c); !t.c.assignable(got, typ) {
+				t.errorf(e.fields[name].Pos(), "field %q has type %v but got %v", name, typ, got)
+			}
+		}
+	case ElidedLit:
+		t.errorf(e.pos, "invalid composite literal %v of type %v", e, e.typ)
+	case FieldAccess:
+		st, ok := t.c.structType(e.lhs.Type(t.c))
+		if !ok {
+			return
+		}
+		if _, ok := st.field(e.field); !ok {
+			t.errorf(e.pos, "%v does not have field %q", e.lhs.Type(t.c), e.field)
+		}
+	}
+}
+
+func (t *typeChecker) errorf(pos Pos, format string, args ...any) {
+	t.errs = append(t.errs, errors.New(posf(pos, format, args...)))
+}
+
+// checkTypeDecls reports aliases that expand to themselves, such as
+// type A = seq[A], and defined types whose underlying type is themselves, such
+// as type A B; type B A
+func (c *Ctx) checkTypeDecls() error {
+	errs := []error{}
+	for _, name := range slices.Sorted(maps.Keys(c.types)) {
+		d := c.types[name]
+		cyclic := false
+		if d.alias {
+			cyclic = c.aliasCycle(d.typ, []string{name})
+		} else {
+			cyclic = c.underlyingCycle(d.typ, []string{name})
+		}
+		if cyclic {
+			errs = append(errs, errors.New(posf(d.pos, "invalid recursive type %s", name)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// aliasCycle reports whether expanding the aliases in t leads back to one of
+// the aliases in seen
+func (c *Ctx) aliasCycle(t Type, seen []string) bool {
+	switch t := t.(type) {
+	case TAbstract:
+		d, ok := c.types[t.name]
+		if !ok || !d.alias {
+			return false
+		}
+		return slices.Contains(seen, t.name) || c.aliasCycle(d.typ, append(seen, t.name))
+	case TSeq:
+		return c.aliasCycle(t.elem, seen)
+	case TSet:
+		return c.aliasCycle(t.elem, seen)
+	case TMset:
+		return c.aliasCycle(t.elem, seen)
+	case TStruct:
+		for _, f := range t.fields {
+			if c.aliasCycle(f.typ, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// underlyingCycle reports whether the chain of named types starting at t leads
+// back to one of the types in seen
+func (c *Ctx) underlyingCycle(t Type, seen []string) bool {
+	named, ok := t.(TAbstract)
+	if !ok {
+		return false
+	}
+	d, ok := c.types[named.name]
+	if !ok {
+		return false
+	}
+	return slices.Contains(seen, named.name) || c.underlyingCycle(d.typ, append(seen, named.name))
+}
+
+// checkTypes checks struct literals and field accesses in all functions and
+// constants against the declared types
+func (c *Ctx) checkTypes() error {
+	tc := typeChecker{c: c}
+	for _, name := range slices.Sorted(maps.Keys(c.consts)) {
+		d := c.consts[name]
+		Walk(&tc, d.value)
+		if got := d.value.Type(c); d.typ != nil && !c.assignable(got, d.typ) {
+			tc.errorf(d.pos, "constant %s has type %v but got %v", name, d.typ, got)
+		}
+	}
+	for _, fn := range c.fns {
+		Walk(&tc, fn.body)
+		for _, e := range fn.requires {
+			Walk(&tc, e)
+		}
+		for _, e := range fn.ensures {
+			Walk(&tc, e)
+		}
+	}
+	return errors.Join(tc.errs...)
+}
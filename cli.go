@@ -0,0 +1,357 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(c Ctx, e Expr, opts options) report
+	// the granularity of the assertions unless one is given by the options
+	granularity granularity
+}
+
+// report is the result of running a command on one input expression. asserts
+// is nil for commands that only evaluate the input.
+type report struct {
+	input   Expr
+	asserts []assertion
+	value   Expr
+	// the full reduction and the call/return pairs, only recorded for
+	// machine-readable output
+	steps []step
+	calls []assertion
+}
+
+// outputFormat selects how the reports are written
+type outputFormat int
+
+const (
+	// the assertions, or values, of each input
+	textFormat outputFormat = iota
+	// a .gobra file with one lemma per input
+	lemmaFormat
+	// a JSON array with the trace of each input
+	jsonFormat
+)
+
+func parseOutputFormat(s string) (outputFormat, error) {
+	switch s {
+	case "text":
+		return textFormat, nil
+	case "lemma":
+		return lemmaFormat, nil
+	case "json":
+		return jsonFormat, nil
+	}
+	return 0, fmt.Errorf("unknown format %q, expected text, lemma or json", s)
+}
+
+// options configure how the commands print their results
+type options struct {
+	abbrevs    []Abbrev
+	autoAbbrev bool
+	bind       bindingKind
+	format     outputFormat
+	// the events asserted, defaultGranularity for the one of the command
+	granularity granularity
+	// the critical events that are asserted
+	filter filter
+	// package clause of lemma files
+	pkg string
+}
+
+// generate generates the assertions of the granularity selected by opts
+func generate(c Ctx, e Expr, opts options) report {
+	return generateAssertions(c, e, opts.granularity, opts.filter)
+}
+
+var commands = []command{
+	{"eval", "print the value of each expression", func(c Ctx, e Expr, _ options) report {
+		return report{input: e, value: lit(evaluatesTo(e, c))}
+	}, defaultGranularity},
+	{"trace", "print the reduction steps of each expression", generate, stepGranularity},
+	{"assert", "print an assertion for every function call and slice made while evaluating each expression", generate, criticalGranularity},
+	{"annotate", "write the assertions of each `// @ interp: expr` marker of the source files below it", generate, criticalGranularity},
+	{"repl", "evaluate expressions read from the standard input", nil, defaultGranularity},
+}
+
+// stringsFlag collects the values of a repeated flag
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// abbrevFlag collects the abbreviations of repeated -abbrev flags
+type abbrevFlag []Abbrev
+
+func (f *abbrevFlag) String() string {
+	names := make([]string, len(*f))
+	for i, a := range *f {
+		names[i] = a.name
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *abbrevFlag) Set(s string) error {
+	a, err := parseAbbrev(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, a)
+	return nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: interpreter <command> [flags] [file or directory]... [expression]...")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Arguments naming an existing file or directory are loaded as sources,")
+	fmt.Fprintln(w, "all others are parsed as expressions. Without sources, the bundled stubs are loaded.")
+	fmt.Fprintln(w, "annotate takes no expressions and rewrites the given sources in place.")
+	fmt.Fprintln(w, "repl takes no expressions; type :help at its prompt for its commands.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run interpreter <command> -h for the flags of a command.")
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// run executes the command line args and returns the exit code
+func run(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return 2
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		usage(os.Stdout)
+		return 0
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		usage(os.Stderr)
+		return 2
+	}
+
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	var includes stringsFlag
+	flags.Var(&includes, "I", "search `dir` for imported packages (repeatable)")
+	var batches stringsFlag
+	flags.Var(&batches, "inputs", "evaluate the expressions listed in `file` (repeatable)")
+	var abbrevs abbrevFlag
+	flags.Var(&abbrevs, "abbrev", "abbreviate an expression in the output as `name=expr` (repeatable)")
+	abbrevFile := flags.String("abbrevs", "", "read abbreviations name = expr, one per line, from `file`")
+	autoAbbrev := flags.Bool("auto-abbrev", true, "abbreviate repeated subterms of the output with generated names")
+	bind := flags.String("bind", "ghost", "declare abbreviations as `ghost` variables or as let bindings (let)")
+	format := flags.String("format", "text", "write the results as `text`, as a .gobra file of lemmas (lemma) or as JSON (json); annotate and repl only write text")
+	granularity := flags.String("granularity", "", "assert every `step`, every call, the calls entering each function but not its recursive calls (toplevel) or every call and slice (critical); the default depends on the command")
+	var include, exclude stringsFlag
+	flags.Var(&include, "include", "only assert calls of functions matching the glob `pattern` (repeatable)")
+	flags.Var(&exclude, "exclude", "do not assert calls of functions matching the glob `pattern` (repeatable)")
+	maxDepth := flags.Int("max-depth", -1, "do not assert calls nested in more than `n` calls; negative for no limit")
+	maxArgSize := flags.Int("max-arg-size", -1, "do not assert events whose arguments have more than `n` expression nodes; negative for no limit")
+	pkg := flags.String("package", "main", "package clause of lemma files; declarations of this `package` are referred to unqualified")
+	output := flags.String("o", "", "write the results to `file` instead of the standard output")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	opts := options{autoAbbrev: *autoAbbrev, pkg: *pkg}
+	opts.filter = filter{include, exclude, *maxDepth, *maxArgSize}
+	if err := opts.filter.checkPatterns(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *abbrevFile != "" {
+		fromFile, err := loadAbbrevs(*abbrevFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		opts.abbrevs = fromFile
+	}
+	opts.abbrevs = append(opts.abbrevs, abbrevs...)
+	var err error
+	if opts.bind, err = parseBindingKind(*bind); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if opts.format, err = parseOutputFormat(*format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if opts.format != textFormat && (cmd.name == "annotate" || cmd.name == "repl") {
+		fmt.Fprintf(os.Stderr, "%s only writes text, -format %s is not supported\n", cmd.name, *format)
+		return 2
+	}
+	if *granularity != "" {
+		if opts.granularity, err = parseGranularity(*granularity); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	sources, exprs := []string{}, []Expr{}
+	for _, arg := range flags.Args() {
+		if _, err := os.Stat(arg); err == nil {
+			sources = append(sources, arg)
+			continue
+		}
+		e, err := parseExpr(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		exprs = append(exprs, e)
+	}
+
+	code := 0
+	for _, path := range batches {
+		batch, errs, err := loadBatch(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		}
+		exprs = append(exprs, batch...)
+	}
+
+	l := Loader{includes: includes}
+	if cmd.name == "repl" {
+		if len(exprs) > 0 {
+			fmt.Fprintln(os.Stderr, "repl takes no expressions")
+			return 2
+		}
+		return newREPL(l, sources, opts).run(os.Stdin, os.Stdout)
+	}
+
+	c, err := l.loadSources(sources)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for i, a := range opts.abbrevs {
+		opts.abbrevs[i].expr = c.resolveInput(a.expr)
+	}
+
+	if cmd.name == "annotate" {
+		if len(exprs) > 0 {
+			fmt.Fprintln(os.Stderr, "annotate takes no expressions")
+			return 2
+		}
+		return max(code, annotateSources(cmd, c, sources, opts))
+	}
+
+	reports := []report{}
+	for _, e := range exprs {
+		input := c.resolveInput(e)
+		if free := freeVars(input); opts.format == lemmaFormat && len(free) > 0 {
+			fmt.Fprintf(os.Stderr, "%v: lemmas need a concrete input, but %s is free\n", e, strings.Join(slices.Sorted(maps.Keys(free)), ", "))
+			code = 1
+			continue
+		}
+		r, err := runExpr(cmd, c, input, opts)
+		if err == nil && opts.format == jsonFormat {
+			err = recordTrace(c, &r, opts)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", e, err)
+			code = 1
+			continue
+		}
+		reports = append(reports, r)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	switch opts.format {
+	case textFormat:
+		for _, r := range reports {
+			writeText(w, r, opts)
+		}
+	case lemmaFormat:
+		writeLemmas(w, &c, reports, opts)
+	case jsonFormat:
+		if err := writeJSON(w, cmd.name, reports); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return code
+}
+
+// runExpr runs cmd on e, turning the panics of the interpreter into an error
+func runExpr(cmd *command, c Ctx, e Expr, opts options) (r report, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.New(fmt.Sprint(p))
+		}
+	}()
+	if opts.granularity == defaultGranularity {
+		opts.granularity = cmd.granularity
+	}
+	if opts.granularity == stepGranularity && opts.filter.selective() {
+		return report{}, errors.New("-include, -exclude, -max-depth and -max-arg-size select calls and slices, they cannot be combined with step granularity")
+	}
+	return cmd.run(c, e, opts), nil
+}
+
+// recordTrace adds the steps and call/return pairs of the input to r
+func recordTrace(c Ctx, r *report, opts options) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.New(fmt.Sprint(p))
+		}
+	}()
+	r.steps = traceSteps(r.input, c, opts.filter)
+	r.calls = generateAssertions(c, r.input, callGranularity, opts.filter).asserts
+	return nil
+}
+
+func writeText(w io.Writer, r report, opts options) {
+	if r.asserts == nil {
+		fmt.Fprintf(w, "%v == %v\n", r.input, r.value)
+		return
+	}
+	fmt.Fprintf(w, "// reducing %s \n", r.input)
+	writeAssertions(w, r.asserts, opts)
+	fmt.Fprintln(w)
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
@@ -13,6 +15,7 @@ type Expr interface {
 	Subst(string, Expr) Expr
 	String() string
 	Type(*Ctx) Type
+	Pos() Pos
 }
 
 func exprsString(e []Expr) []string {
@@ -27,6 +30,7 @@ type Binop struct {
 	opcode binop
 	l      Expr
 	r      Expr
+	pos    Pos
 }
 
 func (b Binop) Step(c *Ctx) (Expr, bool) {
@@ -34,22 +38,32 @@ func (b Binop) Step(c *Ctx) (Expr, bool) {
 	l, didStep := b.l.Step(c)
 	vl, ok := l.ToValue()
 	if !ok || didStep {
-		return Binop{b.opcode, l, b.r}, didStep
+		return Binop{b.opcode, l, b.r, b.pos}, didStep
 	}
 
-	if b.opcode == and {
-		if !asBool(vl) {
-			return BoolLit{false}, true
-		}
+	// the left operand may decide the result on its own, unless it is symbolic
+	bl, concrete := vl.(Bool)
+	switch {
+	case !concrete:
+	case b.opcode == and && !bl.val:
+		c.redex = b
+		return BoolLit{false, b.pos}, true
+	case b.opcode == or && bl.val:
+		c.redex = b
+		return BoolLit{true, b.pos}, true
+	case b.opcode == implies && !bl.val:
+		c.redex = b
+		return BoolLit{true, b.pos}, true
 	}
 
 	r, didStep := b.r.Step(c)
 	vr, ok := r.ToValue()
 	if !ok || didStep {
-		return Binop{b.opcode, l, r}, didStep
+		return Binop{b.opcode, l, r, b.pos}, didStep
 	}
 
-	return lit(evalBinop(b.opcode, vl, vr)), true
+	c.redex = b
+	return withPos(lit(evalBinop(b.opcode, vl, vr)), b.pos), true
 }
 
 func (b Binop) String() string {
@@ -73,6 +87,30 @@ func (b Binop) String() string {
 		op = "<"
 	case and:
 		op = "&&"
+	case or:
+		op = "||"
+	case neq:
+		op = "!="
+	case leq:
+		op = "<="
+	case geq:
+		op = ">="
+	case mod:
+		op = "%"
+	case implies:
+		op = "==>"
+	case in:
+		op = "in"
+	case union:
+		op = "union"
+	case intersection:
+		op = "intersection"
+	case setminus:
+		op = "setminus"
+	case subset:
+		op = "subset"
+	case multiplicity:
+		op = "#"
 	default:
 		panic("unhandled binop" + strconv.Itoa(int(b.opcode)))
 	}
@@ -84,13 +122,52 @@ func (b Binop) ToValue() (Val, bool) {
 }
 
 func (b Binop) Subst(s string, to Expr) Expr {
-	return Binop{b.opcode, b.l.Subst(s, to), b.r.Subst(s, to)}
+	return Binop{b.opcode, b.l.Subst(s, to), b.r.Subst(s, to), b.pos}
+}
+
+type Unop struct {
+	opcode unop
+	e      Expr
+	pos    Pos
+}
+
+func (u Unop) Step(c *Ctx) (Expr, bool) {
+	e, didStep := u.e.Step(c)
+	v, ok := e.ToValue()
+	if !ok || didStep {
+		return Unop{u.opcode, e, u.pos}, didStep
+	}
+
+	c.redex = u
+	return withPos(lit(evalUnop(u.opcode, v)), u.pos), true
+}
+
+func (u Unop) String() string {
+	op := "UNHANDLED"
+	switch u.opcode {
+	case not:
+		op = "!"
+	case neg:
+		op = "-"
+	default:
+		panic("unhandled unop" + strconv.Itoa(int(u.opcode)))
+	}
+	return fmt.Sprintf("(%s%s)", op, u.e.String())
+}
+
+func (u Unop) ToValue() (Val, bool) {
+	return nil, false
+}
+
+func (u Unop) Subst(s string, to Expr) Expr {
+	return Unop{u.opcode, u.e.Subst(s, to), u.pos}
 }
 
 type Ternop struct {
 	cond Expr
 	yes  Expr
 	no   Expr
+	pos  Pos
 }
 
 func (t Ternop) String() string {
@@ -107,14 +184,15 @@ func (t Ternop) Step(c *Ctx) (Expr, bool) {
 	cond, didStep := t.cond.Step(c)
 	val, ok := cond.ToValue()
 	if !ok || didStep {
-		return Ternop{cond, t.yes, t.no}, didStep
+		return Ternop{cond, t.yes, t.no, t.pos}, didStep
 	}
 
 	valb, ok := val.(Bool)
 	if !ok || didStep {
-		panic("non-boolean condition")
+		panic(posf(t.cond.Pos(), "non-boolean condition %v", cond))
 	}
 
+	c.redex = t
 	if valb.val {
 		return t.yes, true
 	} else {
@@ -127,16 +205,79 @@ func (b Ternop) ToValue() (Val, bool) {
 }
 
 func (b Ternop) Subst(s string, to Expr) Expr {
-	return Ternop{b.cond.Subst(s, to), b.yes.Subst(s, to), b.no.Subst(s, to)}
+	return Ternop{b.cond.Subst(s, to), b.yes.Subst(s, to), b.no.Subst(s, to), b.pos}
+}
+
+// Let binds name to the value of value in body
+type Let struct {
+	name  string
+	value Expr
+	body  Expr
+	pos   Pos
+}
+
+func (t Let) String() string {
+	return fmt.Sprintf("(let %s := %v in %v)", t.name, t.value, t.body)
+}
+
+func (t Let) Step(c *Ctx) (Expr, bool) {
+	value, didStep := t.value.Step(c)
+	if _, ok := value.ToValue(); !ok || didStep {
+		return Let{t.name, value, t.body, t.pos}, didStep
+	}
+
+	c.redex = t
+	return t.body.Subst(t.name, value), true
+}
+
+func (t Let) ToValue() (Val, bool) {
+	return nil, false
+}
+
+// Subst replaces the free occurrences of s. The bound name is renamed first if
+// to mentions it, so that the variables of to are not captured.
+func (t Let) Subst(s string, to Expr) Expr {
+	t.value = t.value.Subst(s, to)
+	if s == t.name {
+		return t
+	}
+	if free := freeVars(to); free[t.name] {
+		free[s] = true
+		fresh := freshName(t.name, free, t.body)
+		t.body = t.body.Subst(t.name, Var{fresh, t.pos})
+		t.name = fresh
+	}
+	t.body = t.body.Subst(s, to)
+	return t
+}
+
+// freshName returns a variant of name that is neither in taken nor used in e
+func freshName(name string, taken map[string]bool, e Expr) string {
+	used := maps.Clone(taken)
+	Walk(visitor(func(e Expr) {
+		switch e := e.(type) {
+		case Var:
+			used[e.Name] = true
+		case Let:
+			used[e.name] = true
+		}
+	}), e)
+	for i := 0; ; i++ {
+		fresh := fmt.Sprintf("%s%d", name, i)
+		if !used[fresh] {
+			return fresh
+		}
+	}
 }
 
 type Call struct {
 	name string
 	args []Expr
-}
-
-func call(name string, args ...Expr) Call {
-	return Call{name, args}
+	pos  Pos
+	// the function from whose body the call was reached, empty for the calls
+	// of the input, and the number of calls it is nested in
+	caller string
+	depth  int
 }
 
 func (t Call) String() string {
@@ -157,25 +298,43 @@ func (t Call) Step(c *Ctx) (Expr, bool) {
 		args[i], didStep = arg.Step(c)
 		_, ok = args[i].ToValue()
 		if !ok || didStep {
-			return Call{t.name, args}, didStep
+			res := t
+			res.args = args
+			return res, didStep
 		}
 	}
 
-	if t.name == "len" {
+	c.redex = t
+	switch t.name {
+	case "len":
 		v, _ := args[0].ToValue()
-		return IntLit{len(asSeq(v).elems)}, true
+		return IntLit{length(v), t.pos}, true
+	case "set":
+		v, _ := args[0].ToValue()
+		s := asSeq(v)
+		return withPos(lit(newSet(TSet{c.elemType(s.typ)}, s.elems)), t.pos), true
+	case "mset":
+		v, _ := args[0].ToValue()
+		s := asSeq(v)
+		return withPos(lit(newMset(TMset{c.elemType(s.typ)}, s.elems)), t.pos), true
 	}
 
-	c.callExprs = append(c.callExprs, Call{t.name, args})
-	c.criticalExprs = append(c.criticalExprs, Call{t.name, args})
-
-	fun := c.getFn(t.name)
-	res := fun.body
+	t.args = args
+	c.callExprs = append(c.callExprs, t)
+	c.criticalExprs = append(c.criticalExprs, t)
 
-	assert(len(fun.vars) == len(args), fmt.Sprintf("wrong number of arguments for %s", t.name))
-	for i, name := range fun.vars {
-		res = res.Subst(name, args[i])
+	fun := c.getFn(t.name, t.pos)
+	if fun.body == nil {
+		panic(posf(t.pos, "function %s has no body", t.name))
 	}
+	body := Rewrite(fun.body, func(e Expr) Expr {
+		if inner, ok := e.(Call); ok {
+			inner.caller, inner.depth = t.name, t.depth+1
+			return inner
+		}
+		return e
+	})
+	res := fun.bind(body, args)
 	c.critical = t
 
 	return res, true
@@ -191,12 +350,14 @@ func (b Call) Subst(s string, to Expr) Expr {
 		args[i] = arg.Subst(s, to)
 	}
 
-	return Call{b.name, args}
+	b.args = args
+	return b
 }
 
 type SeqLit struct {
 	typ  Type
 	args []Expr
+	pos  Pos
 }
 
 func (t SeqLit) String() string {
@@ -218,10 +379,10 @@ func (t SeqLit) Step(c *Ctx) (Expr, bool) {
 		anyStep = anyStep || didStep
 		_, ok := elems[i].ToValue()
 		if !ok || didStep {
-			return SeqLit{t.Type(c), elems}, didStep
+			return SeqLit{t.Type(c), elems, t.pos}, didStep
 		}
 	}
-	return SeqLit{t.Type(c), elems}, anyStep
+	return SeqLit{t.Type(c), elems, t.pos}, anyStep
 }
 
 func (b SeqLit) ToValue() (Val, bool) {
@@ -243,12 +404,185 @@ func (b SeqLit) Subst(s string, to Expr) Expr {
 		args[i] = arg.Subst(s, to)
 	}
 
-	return SeqLit{b.typ, args}
+	return SeqLit{b.typ, args, b.pos}
+}
+
+// SetLit is a set or, if its type is a TMset, a multiset literal. Its
+// elements may repeat and come in any order.
+type SetLit struct {
+	typ  Type
+	args []Expr
+	pos  Pos
+}
+
+func (t SetLit) String() string {
+	return fmt.Sprintf("%s{%s}", t.typ, strings.Join(exprsString(t.args), ", "))
+}
+
+func (t SetLit) Step(c *Ctx) (Expr, bool) {
+	elems := append([]Expr{}, t.args...)
+	for i, arg := range elems {
+		var didStep bool
+		elems[i], didStep = arg.Step(c)
+		if _, ok := elems[i].ToValue(); !ok || didStep {
+			return SetLit{t.typ, elems, t.pos}, didStep
+		}
+	}
+	return SetLit{t.typ, elems, t.pos}, false
+}
+
+func (t SetLit) ToValue() (Val, bool) {
+	v := make([]Val, len(t.args))
+	var ok bool
+	for i, el := range t.args {
+		v[i], ok = el.ToValue()
+		if !ok {
+			return nil, false
+		}
+	}
+	if _, ok := t.typ.(TMset); ok {
+		return newMset(t.typ, v), true
+	}
+	return newSet(t.typ, v), true
+}
+
+func (t SetLit) Subst(s string, to Expr) Expr {
+	args := make([]Expr, len(t.args))
+	for i, arg := range t.args {
+		args[i] = arg.Subst(s, to)
+	}
+	return SetLit{t.typ, args, t.pos}
+}
+
+// KeyedSeqLit is a sequence literal whose elements are given with their
+// indices, like seq[int]{2: 1, 0: 3}. An element without a key follows the
+// previous one; the elements not given are the zero value of the element type.
+type KeyedSeqLit struct {
+	typ  TSeq
+	keys []Expr // nil for the elements without a key
+	args []Expr
+	pos  Pos
+}
+
+func (t KeyedSeqLit) String() string {
+	elems := make([]string, len(t.args))
+	for i, arg := range t.args {
+		elems[i] = arg.String()
+		if t.keys[i] != nil {
+			elems[i] = fmt.Sprintf("%v: %v", t.keys[i], arg)
+		}
+	}
+	return fmt.Sprintf("%s{%s}", t.typ, strings.Join(elems, ", "))
+}
+
+func (t KeyedSeqLit) Step(c *Ctx) (Expr, bool) {
+	keys := append([]Expr{}, t.keys...)
+	args := append([]Expr{}, t.args...)
+	for i := range args {
+		for _, e := range []*Expr{&keys[i], &args[i]} {
+			if *e == nil {
+				continue
+			}
+			var didStep bool
+			*e, didStep = (*e).Step(c)
+			if _, ok := (*e).ToValue(); !ok || didStep {
+				return KeyedSeqLit{t.typ, keys, args, t.pos}, didStep
+			}
+		}
+	}
+
+	elems := map[int]Expr{}
+	n, next := 0, 0
+	for i, arg := range args {
+		if keys[i] != nil {
+			k, _ := keys[i].ToValue()
+			next = asInt(k)
+		}
+		if next < 0 {
+			panic(posf(t.pos, "negative index %d in sequence literal", next))
+		}
+		if _, ok := elems[next]; ok {
+			panic(posf(t.pos, "duplicate index %d in sequence literal", next))
+		}
+		elems[next] = arg
+		next++
+		n = max(n, next)
+	}
+
+	res := make([]Expr, n)
+	for i := range res {
+		if e, ok := elems[i]; ok {
+			res[i] = e
+		} else {
+			res[i] = lit(c.zeroValue(t.typ.elem))
+		}
+	}
+	c.redex = t
+	return SeqLit{t.typ, res, t.pos}, true
+}
+
+func (t KeyedSeqLit) ToValue() (Val, bool) {
+	return nil, false
+}
+
+func (t KeyedSeqLit) Subst(s string, to Expr) Expr {
+	keys := make([]Expr, len(t.keys))
+	for i, key := range t.keys {
+		if key != nil {
+			keys[i] = key.Subst(s, to)
+		}
+	}
+	args := make([]Expr, len(t.args))
+	for i, arg := range t.args {
+		args[i] = arg.Subst(s, to)
+	}
+	return KeyedSeqLit{t.typ, keys, args, t.pos}
+}
+
+// SeqRange is the sequence of the integers from low up to, but excluding, high
+type SeqRange struct {
+	low  Expr
+	high Expr
+	pos  Pos
+}
+
+func (t SeqRange) String() string {
+	return fmt.Sprintf("seq[%v..%v]", t.low, t.high)
+}
+
+func (t SeqRange) Step(c *Ctx) (Expr, bool) {
+	low, didStep := t.low.Step(c)
+	l, ok := low.ToValue()
+	if !ok || didStep {
+		return SeqRange{low, t.high, t.pos}, didStep
+	}
+
+	high, didStep := t.high.Step(c)
+	h, ok := high.ToValue()
+	if !ok || didStep {
+		return SeqRange{low, high, t.pos}, didStep
+	}
+
+	elems := []Expr{}
+	for i := asInt(l); i < asInt(h); i++ {
+		elems = append(elems, intLit(i))
+	}
+	c.redex = t
+	return SeqLit{TSeq{tint()}, elems, t.pos}, true
+}
+
+func (t SeqRange) ToValue() (Val, bool) {
+	return nil, false
+}
+
+func (t SeqRange) Subst(s string, to Expr) Expr {
+	return SeqRange{t.low.Subst(s, to), t.high.Subst(s, to), t.pos}
 }
 
 type StructLit struct {
 	typ    string
 	fields map[string]Expr
+	pos    Pos
 }
 
 func (t StructLit) String() string {
@@ -256,10 +590,10 @@ func (t StructLit) String() string {
 	res.WriteString(t.typ)
 	res.WriteByte('{')
 
-	for k, v := range t.fields {
+	for _, k := range slices.Sorted(maps.Keys(t.fields)) {
 		res.WriteString(k)
 		res.WriteByte(':')
-		res.WriteString(v.String())
+		res.WriteString(t.fields[k].String())
 		res.WriteByte(',')
 	}
 
@@ -277,15 +611,20 @@ func (t StructLit) Step(c *Ctx) (Expr, bool) {
 	var didStep bool
 	anyStep := false
 
-	for k, v := range t.fields {
-		elems[k], didStep = v.Step(c)
+	for _, k := range slices.Sorted(maps.Keys(t.fields)) {
+		elems[k], didStep = t.fields[k].Step(c)
 		anyStep = anyStep || didStep
 		_, ok := elems[k].ToValue()
 		if !ok || didStep {
-			return StructLit{t.typ, elems}, anyStep
+			return StructLit{t.typ, elems, t.pos}, anyStep
 		}
 	}
-	return StructLit{t.typ, elems}, anyStep
+
+	res := StructLit{t.typ, elems, t.pos}
+	if v, ok := res.ToValue(); ok {
+		c.checkStruct(v.(Struct), t.pos)
+	}
+	return res, anyStep
 }
 
 func (b StructLit) ToValue() (Val, bool) {
@@ -308,13 +647,55 @@ func (b StructLit) Subst(s string, to Expr) Expr {
 		args[field] = val.Subst(s, to)
 	}
 
-	return StructLit{b.typ, args}
+	return StructLit{b.typ, args, b.pos}
+}
+
+// ElidedLit is an element of a composite literal whose type is elided and
+// known only by name, so that it may stand for a sequence, set or struct
+// literal. Its own elements may elide their type, which is then unknown until
+// resolveExpr replaces the literal by the one it stands for.
+type ElidedLit struct {
+	typ Type // nil within another ElidedLit
+	// the elements of a sequence or set literal, keyed as in KeyedSeqLit
+	keys []Expr
+	args []Expr
+	// the fields of a struct literal, nil for other literals
+	fields map[string]Expr
+	pos    Pos
+}
+
+func (t ElidedLit) String() string {
+	elems := []string{}
+	for _, k := range slices.Sorted(maps.Keys(t.fields)) {
+		elems = append(elems, fmt.Sprintf("%s: %v", k, t.fields[k]))
+	}
+	for i, arg := range t.args {
+		if t.keys[i] != nil {
+			elems = append(elems, fmt.Sprintf("%v: %v", t.keys[i], arg))
+		} else {
+			elems = append(elems, arg.String())
+		}
+	}
+	return fmt.Sprintf("{%s}", strings.Join(elems, ", "))
+}
+
+func (t ElidedLit) Step(c *Ctx) (Expr, bool) {
+	panic(posf(t.pos, "composite literal %v of unknown type", t))
+}
+
+func (t ElidedLit) ToValue() (Val, bool) {
+	return nil, false
+}
+
+func (t ElidedLit) Subst(s string, to Expr) Expr {
+	return mapChildren(t, func(e Expr) Expr { return e.Subst(s, to) })
 }
 
 type SeqSlice struct {
 	s    Expr
 	low  Expr
 	high Expr
+	pos  Pos
 }
 
 func (t SeqSlice) String() string {
@@ -334,7 +715,7 @@ func (t SeqSlice) Step(c *Ctx) (Expr, bool) {
 	s, didStep := t.s.Step(c)
 	s2, ok := s.ToValue()
 	if !ok || didStep {
-		return SeqSlice{s, t.low, t.high}, didStep
+		return SeqSlice{s, t.low, t.high, t.pos}, didStep
 	}
 
 	seq := asSeq(s2)
@@ -349,7 +730,7 @@ func (t SeqSlice) Step(c *Ctx) (Expr, bool) {
 		lowRed, didStep = t.low.Step(c)
 		l, ok := lowRed.ToValue()
 		if !ok || didStep {
-			return SeqSlice{s, lowRed, t.high}, didStep
+			return SeqSlice{s, lowRed, t.high, t.pos}, didStep
 		}
 		low = asInt(l)
 	}
@@ -358,7 +739,7 @@ func (t SeqSlice) Step(c *Ctx) (Expr, bool) {
 		highRed, didStep = t.high.Step(c)
 		h, ok := highRed.ToValue()
 		if !ok || didStep {
-			return SeqSlice{s, lowRed, highRed}, didStep
+			return SeqSlice{s, lowRed, highRed, t.pos}, didStep
 		}
 		high = asInt(h)
 	}
@@ -372,8 +753,9 @@ func (t SeqSlice) Step(c *Ctx) (Expr, bool) {
 	if low != 0 {
 		c.critical = t
 	}
+	c.redex = t
 
-	expr := SeqLit{seq.typ, res}
+	expr := SeqLit{seq.typ, res, t.pos}
 	expr.typ = expr.Type(c)
 	return expr, true
 }
@@ -396,12 +778,13 @@ func (b SeqSlice) Subst(s string, to Expr) Expr {
 		high = b.high.Subst(s, to)
 	}
 
-	return SeqSlice{seq, low, high}
+	return SeqSlice{seq, low, high, b.pos}
 }
 
 type SeqIndex struct {
-	s Expr
-	i Expr
+	s   Expr
+	i   Expr
+	pos Pos
 }
 
 func (s SeqIndex) String() string {
@@ -412,16 +795,17 @@ func (t SeqIndex) Step(c *Ctx) (Expr, bool) {
 	s, didStep := t.s.Step(c)
 	seq, ok := s.ToValue()
 	if !ok || didStep {
-		return SeqIndex{s, t.i}, didStep
+		return SeqIndex{s, t.i, t.pos}, didStep
 	}
 
 	i, didStep := t.i.Step(c)
 	index, ok := i.ToValue()
 	if !ok || didStep {
-		return SeqIndex{s, i}, didStep
+		return SeqIndex{s, i, t.pos}, didStep
 	}
 
-	return lit(asSeq(seq).elems[asInt(index)]), true
+	c.redex = t
+	return withPos(lit(asSeq(seq).elems[asInt(index)]), t.pos), true
 }
 
 func (b SeqIndex) ToValue() (Val, bool) {
@@ -429,11 +813,66 @@ func (b SeqIndex) ToValue() (Val, bool) {
 }
 
 func (b SeqIndex) Subst(s string, to Expr) Expr {
-	return SeqIndex{b.s.Subst(s, to), b.i.Subst(s, to)}
+	return SeqIndex{b.s.Subst(s, to), b.i.Subst(s, to), b.pos}
+}
+
+// SeqUpdate is the sequence s with the element at index i replaced by v
+type SeqUpdate struct {
+	s   Expr
+	i   Expr
+	v   Expr
+	pos Pos
+}
+
+func (t SeqUpdate) String() string {
+	return fmt.Sprintf("%v[%v = %v]", t.s, t.i, t.v)
+}
+
+func (t SeqUpdate) Step(c *Ctx) (Expr, bool) {
+	s, didStep := t.s.Step(c)
+	seq, ok := s.ToValue()
+	if !ok || didStep {
+		return SeqUpdate{s, t.i, t.v, t.pos}, didStep
+	}
+
+	i, didStep := t.i.Step(c)
+	index, ok := i.ToValue()
+	if !ok || didStep {
+		return SeqUpdate{s, i, t.v, t.pos}, didStep
+	}
+
+	v, didStep := t.v.Step(c)
+	val, ok := v.ToValue()
+	if !ok || didStep {
+		return SeqUpdate{s, i, v, t.pos}, didStep
+	}
+
+	elems := asSeq(seq).elems
+	n := asInt(index)
+	if n < 0 || n >= len(elems) {
+		panic(posf(t.pos, "index %d out of range for sequence of length %d", n, len(elems)))
+	}
+	res := make([]Expr, len(elems))
+	for j, e := range elems {
+		res[j] = lit(e)
+	}
+	res[n] = lit(val)
+
+	c.redex = t
+	return SeqLit{asSeq(seq).typ, res, t.pos}, true
+}
+
+func (t SeqUpdate) ToValue() (Val, bool) {
+	return nil, false
+}
+
+func (t SeqUpdate) Subst(s string, to Expr) Expr {
+	return SeqUpdate{t.s.Subst(s, to), t.i.Subst(s, to), t.v.Subst(s, to), t.pos}
 }
 
 type IntLit struct {
 	val int
+	pos Pos
 }
 
 func (t IntLit) Step(c *Ctx) (Expr, bool) {
@@ -460,6 +899,7 @@ func (b IntLit) String() string {
 
 type BoolLit struct {
 	val bool
+	pos Pos
 }
 
 func (b BoolLit) String() string {
@@ -483,6 +923,7 @@ func (b BoolLit) Subst(s string, to Expr) Expr {
 
 type SymLit struct {
 	val SymVal
+	pos Pos
 }
 
 func (b SymLit) String() string {
@@ -508,40 +949,50 @@ func lit(v Val) Expr {
 		for i, e := range val.elems {
 			elems[i] = lit(e)
 		}
-		return SeqLit{val.typ, elems}
+		return SeqLit{typ: val.typ, args: elems}
+	case Set:
+		elems := make([]Expr, len(val.elems))
+		for i, e := range val.elems {
+			elems[i] = lit(e)
+		}
+		return SetLit{typ: val.typ, args: elems}
+	case Mset:
+		elems := make([]Expr, len(val.elems))
+		for i, e := range val.elems {
+			elems[i] = lit(e)
+		}
+		return SetLit{typ: val.typ, args: elems}
 	case Int:
-		return IntLit{val.val}
+		return IntLit{val: val.val}
 	case Bool:
-		return BoolLit{val.val}
+		return BoolLit{val: val.val}
 	case Struct:
 		elems := make(map[string]Expr)
 		for k, v := range val.fields {
 			elems[k] = lit(v)
 		}
-		return StructLit{val.typ, elems}
+		return StructLit{typ: val.typ, fields: elems}
 	case SymVal:
-		return SymLit{val}
+		return SymLit{val: val}
 	}
 	panic("")
 }
 
-func chr(i byte) IntLit {
-	return IntLit{int(i)}
+func intLit(i int) IntLit {
+	return IntLit{val: i}
 }
 
-func tseq(t Type, args ...Expr) SeqLit {
-	return SeqLit{TSeq{t}, args}
+func binary(op binop, l, r Expr) Binop {
+	return Binop{opcode: op, l: l, r: r}
 }
 
-func seq(args ...Expr) SeqLit {
-	res := SeqLit{nil, args}
-	empty := EmptyCtx()
-	res.typ = res.Type(&empty)
-	return res
+func unary(op unop, e Expr) Unop {
+	return Unop{opcode: op, e: e}
 }
 
 type Var struct {
 	Name string
+	pos  Pos
 }
 
 func (v Var) String() string {
@@ -563,9 +1014,45 @@ func (b Var) Subst(s string, to Expr) Expr {
 	return b
 }
 
+// ConstDecl is a package-level constant. Untyped constants have a nil typ.
+type ConstDecl struct {
+	name  string
+	typ   Type
+	value Expr
+	pos   Pos
+}
+
+// Const refers to a package-level constant and steps to its value
+type Const struct {
+	name string
+	pos  Pos
+}
+
+func (v Const) String() string {
+	return v.name
+}
+
+func (t Const) Step(c *Ctx) (Expr, bool) {
+	d, ok := c.consts[t.name]
+	if !ok {
+		panic(posf(t.pos, "constant %s not found", t.name))
+	}
+	c.redex = t
+	return withPos(d.value, t.pos), true
+}
+
+func (b Const) ToValue() (Val, bool) {
+	return nil, false
+}
+
+func (b Const) Subst(s string, to Expr) Expr {
+	return b
+}
+
 type FieldAccess struct {
 	lhs   Expr
 	field string
+	pos   Pos
 }
 
 func (v FieldAccess) String() string {
@@ -576,19 +1063,26 @@ func (t FieldAccess) Step(c *Ctx) (Expr, bool) {
 	e, didStep := t.lhs.Step(c)
 	lhs, ok := e.ToValue()
 	if didStep || !ok {
-		return e, didStep
+		return FieldAccess{e, t.field, t.pos}, didStep
 	}
 	lhsS, ok := lhs.(Struct)
 	if !ok {
-		panic(fmt.Sprintf("field access %v requires lhs to be struct", e))
+		panic(posf(t.pos, "field access %v requires lhs to be struct", e))
 	}
+	c.checkStruct(lhsS, t.pos)
 
 	res, ok := lhsS.fields[t.field]
 	if !ok {
-		panic(fmt.Sprintf("struct %q does not have field %q", lhsS.typ, t.field))
+		st, _ := c.structType(TAbstract{lhsS.typ})
+		typ, declared := st.field(t.field)
+		if !declared {
+			panic(posf(t.pos, "struct %q does not have field %q", lhsS.typ, t.field))
+		}
+		res = c.zeroValue(typ)
 	}
+	c.redex = t
 
-	return lit(res), true
+	return withPos(lit(res), t.pos), true
 }
 
 func (b FieldAccess) ToValue() (Val, bool) {
@@ -596,17 +1090,102 @@ func (b FieldAccess) ToValue() (Val, bool) {
 }
 
 func (b FieldAccess) Subst(s string, to Expr) Expr {
-	return FieldAccess{b.lhs.Subst(s, to), b.field}
+	return FieldAccess{b.lhs.Subst(s, to), b.field, b.pos}
 }
 
 func v(s string) Var {
-	return Var{s}
+	return Var{Name: s}
 }
 
 type Func struct {
-	Name string
-	body Expr
-	vars []string
-	// argtypes []Type
-	rettyp Type
+	Name     string
+	body     Expr
+	vars     []string
+	argtypes []Type
+	rettyp   Type
+	// name of the result parameter, empty if the result is unnamed
+	result    string
+	requires  []Expr
+	ensures   []Expr
+	decreases []Expr
+	pos       Pos
+}
+
+// bind substitutes args for the parameters of f in e
+func (f Func) bind(e Expr, args []Expr) Expr {
+	assert(len(f.vars) == len(args), fmt.Sprintf("wrong number of arguments for %s", f.Name))
+	return substAll(e, f.vars, args)
+}
+
+func (f Func) bindAll(es []Expr, args []Expr) []Expr {
+	res := make([]Expr, len(es))
+	for i, e := range es {
+		res[i] = f.bind(e, args)
+	}
+	return res
+}
+
+// substAll substitutes tos[i] for names[i] in e, all at once
+func substAll(e Expr, names []string, tos []Expr) Expr {
+	// the names are renamed apart first, so that a replacement mentioning a
+	// later name is not substituted again
+	taken := map[string]bool{}
+	for _, to := range tos {
+		maps.Copy(taken, freeVars(to))
+	}
+	fresh := make([]string, len(names))
+	for i, name := range names {
+		fresh[i] = freshName(name, taken, e)
+		taken[fresh[i]] = true
+	}
+	for i, name := range names {
+		e = e.Subst(name, v(fresh[i]))
+	}
+	for i := range names {
+		e = e.Subst(fresh[i], tos[i])
+	}
+	return e
+}
+
+// Requires returns the preconditions of a call to f with args
+func (f Func) Requires(args []Expr) []Expr {
+	return f.bindAll(f.requires, args)
+}
+
+// Ensures returns the postconditions of a call to f with args, where res is
+// the result of the call
+func (f Func) Ensures(args []Expr, res Expr) []Expr {
+	if f.result == "" {
+		return f.bindAll(f.ensures, args)
+	}
+	assert(len(f.vars) == len(args), fmt.Sprintf("wrong number of arguments for %s", f.Name))
+	names := append(slices.Clone(f.vars), f.result)
+	tos := append(slices.Clone(args), res)
+	ensures := make([]Expr, len(f.ensures))
+	for i, e := range f.ensures {
+		ensures[i] = substAll(e, names, tos)
+	}
+	return ensures
+}
+
+// Decreases returns the termination measures of a call to f with args
+func (f Func) Decreases(args []Expr) []Expr {
+	return f.bindAll(f.decreases, args)
+}
+
+// Signature returns the name, parameters and result of f as in its declaration
+func (f Func) Signature() string {
+	params := make([]string, len(f.vars))
+	for i, name := range f.vars {
+		params[i] = fmt.Sprintf("%s %v", name, f.argtypes[i])
+	}
+	res := fmt.Sprintf("%s(%s)", f.Name, strings.Join(params, ", "))
+	switch {
+	case f.rettyp == nil:
+	case f.result != "":
+		res += fmt.Sprintf(" (%s %v)", f.result, f.rettyp)
+	default:
+		res += fmt.Sprintf(" %v", f.rettyp)
+	}
+	return res
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/antlr4-go/antlr/v4"
+)
+
+const substSrc = `package main
+
+ghost
+decreases
+pure func k(x0 int) int {
+	return let x := 1 in x
+}
+
+ghost
+decreases
+pure func h(x, y int) int {
+	return x - y
+}
+
+ghost
+requires x >= 0
+ensures res == x + 1
+decreases x
+pure func inc(x int) (res int) {
+	return x + 1
+}
+`
+
+func TestSubstAvoidsCapture(t *testing.T) {
+	f, err := parseFile(antlr.NewInputStream(substSrc), "subst.gobra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Loader{}.build([]*File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		// the let must not capture the argument substituted for x0
+		{"k(x)", "1"},
+		// the argument of x must not be substituted for y
+		{"h(y, 1)", "(y - 1)"},
+		{"h(y, x)", "(y - x)"},
+		{"h(3, 1)", "2"},
+	}
+	for _, tt := range tests {
+		e, err := parseExpr(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := lit(evaluatesTo(c.resolveInput(e), c)).String(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLetSubstAvoidsCapture(t *testing.T) {
+	e, err := parseExpr("let x := 1 in x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := lit(evaluatesTo(e.Subst("x0", v("x")), Ctx{})).String()
+	if want := "1"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestSpecBinding(t *testing.T) {
+	f, err := parseFile(antlr.NewInputStream(substSrc), "subst.gobra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := slices.IndexFunc(f.funcs, func(fn Func) bool { return fn.Name == "inc" })
+	if i < 0 {
+		t.Fatal("inc not found")
+	}
+	inc := f.funcs[i]
+
+	tests := []struct {
+		name string
+		got  []Expr
+		want string
+	}{
+		{"requires", inc.Requires([]Expr{v("y")}), "(y >= 0)"},
+		// the argument must not be taken for the result
+		{"ensures", inc.Ensures([]Expr{v("res")}, intLit(7)), "(7 == (res + 1))"},
+		{"decreases", inc.Decreases([]Expr{intLit(3)}), "3"},
+	}
+	for _, tt := range tests {
+		if len(tt.got) != 1 {
+			t.Errorf("%s: got %d clauses, want 1", tt.name, len(tt.got))
+		} else if got := tt.got[0].String(); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"path"
+)
+
+// filter selects the critical events that are recorded while tracing a
+// reduction
+type filter struct {
+	// glob patterns of the names of the functions whose calls are kept, all
+	// functions if empty
+	include []string
+	// glob patterns of the names of the functions whose calls are dropped
+	exclude []string
+	// the deepest nesting of a kept call, the calls of the input being at depth
+	// 0; negative for no limit
+	maxDepth int
+	// the largest size of the arguments of a kept event, counted in
+	// expression nodes; negative for no limit
+	maxArgSize int
+}
+
+// checkPatterns reports the first malformed pattern of the filter
+func (f filter) checkPatterns() error {
+	for _, pattern := range append(append([]string{}, f.include...), f.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// selective reports whether the filter can drop any event
+func (f filter) selective() bool {
+	return len(f.include) > 0 || len(f.exclude) > 0 || f.maxDepth >= 0 || f.maxArgSize >= 0
+}
+
+// keeps reports whether the critical event e passes the filter. Only calls
+// can match an include pattern; the exclude patterns and the depth limit do not
+// apply to other events.
+func (f filter) keeps(e Expr) bool {
+	args := []Expr{e}
+	switch e := e.(type) {
+	case Call:
+		if len(f.include) > 0 && !matchesAny(f.include, e.name) {
+			return false
+		}
+		if matchesAny(f.exclude, e.name) {
+			return false
+		}
+		if f.maxDepth >= 0 && e.depth > f.maxDepth {
+			return false
+		}
+		args = e.args
+	case SeqSlice:
+		args = []Expr{e.s}
+	}
+	if _, isCall := e.(Call); !isCall && len(f.include) > 0 {
+		return false
+	}
+
+	if f.maxArgSize >= 0 {
+		size := 0
+		for _, arg := range args {
+			size += exprSize(arg)
+		}
+		return size <= f.maxArgSize
+	}
+	return true
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// exprSize counts the nodes of e
+func exprSize(e Expr) int {
+	n := 0
+	Walk(visitor(func(Expr) { n++ }), e)
+	return n
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type jsonReport struct {
+	Command    string          `json:"command"`
+	Input      string          `json:"input"`
+	Value      string          `json:"value"`
+	Steps      []jsonStep      `json:"steps"`
+	Calls      []jsonCall      `json:"calls"`
+	Assertions []jsonAssertion `json:"assertions,omitempty"`
+}
+
+type jsonStep struct {
+	Expr     string `json:"expr"`
+	Redex    string `json:"redex,omitempty"`
+	RedexPos string `json:"redexPos,omitempty"`
+	Critical string `json:"critical,omitempty"`
+}
+
+// jsonCall is a critical call and the value it returns
+type jsonCall struct {
+	Call   string `json:"call"`
+	Result string `json:"result"`
+	Pos    string `json:"pos,omitempty"`
+}
+
+type jsonAssertion struct {
+	Lhs string `json:"lhs"`
+	Rhs string `json:"rhs"`
+	Pos string `json:"pos,omitempty"`
+}
+
+func exprString(e Expr) string {
+	if e == nil {
+		return ""
+	}
+	return e.String()
+}
+
+func posString(e Expr) string {
+	if e == nil || !e.Pos().IsValid() {
+		return ""
+	}
+	return e.Pos().String()
+}
+
+func jsonAssertions(asserts []assertion) []jsonAssertion {
+	if asserts == nil {
+		return nil
+	}
+	res := make([]jsonAssertion, len(asserts))
+	for i, a := range asserts {
+		res[i] = jsonAssertion{a.lhs.String(), a.rhs.String(), posString(a.lhs)}
+	}
+	return res
+}
+
+// writeJSON writes the reports of command as an indented JSON array.
+// Assertions are written without abbreviations.
+func writeJSON(w io.Writer, command string, reports []report) error {
+	res := make([]jsonReport, len(reports))
+	for i, r := range reports {
+		steps := make([]jsonStep, len(r.steps))
+		for j, s := range r.steps {
+			steps[j] = jsonStep{s.expr.String(), exprString(s.redex), posString(s.redex), exprString(s.critical)}
+		}
+		calls := make([]jsonCall, len(r.calls))
+		for j, a := range r.calls {
+			calls[j] = jsonCall{a.lhs.String(), a.rhs.String(), posString(a.lhs)}
+		}
+		res[i] = jsonReport{
+			Command:    command,
+			Input:      r.input.String(),
+			Value:      r.value.String(),
+			Steps:      steps,
+			Calls:      calls,
+			Assertions: jsonAssertions(r.asserts),
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(res)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// writeLemmas writes a .gobra file of package opts.pkg with one ghost lemma
+// per report. Each lemma asserts the steps of its report and ensures the
+// final value of the input.
+func writeLemmas(w io.Writer, c *Ctx, reports []report, opts options) {
+	local := func(name string) string {
+		if rest, ok := strings.CutPrefix(name, opts.pkg+"."); ok {
+			return rest
+		}
+		return name
+	}
+	localize := func(e Expr) Expr { return renameDecls(e, local) }
+
+	pkgs := map[string]bool{}
+	use := func(name string) string {
+		if pkg, _, ok := strings.Cut(name, "."); ok {
+			pkgs[pkg] = true
+		}
+		return name
+	}
+
+	for i, r := range reports {
+		r.input, r.value = localize(r.input), localize(r.value)
+		asserts := make([]assertion, len(r.asserts))
+		for j, a := range r.asserts {
+			asserts[j] = assertion{localize(a.lhs), localize(a.rhs)}
+			renameDecls(asserts[j].lhs, use)
+			renameDecls(asserts[j].rhs, use)
+		}
+		r.asserts = asserts
+		renameDecls(r.input, use)
+		renameDecls(r.value, use)
+		reports[i] = r
+	}
+	abbrevs := make([]Abbrev, len(opts.abbrevs))
+	for i, a := range opts.abbrevs {
+		abbrevs[i] = Abbrev{a.name, localize(a.expr)}
+		renameDecls(abbrevs[i].expr, use)
+	}
+	opts.abbrevs = abbrevs
+
+	fmt.Fprintf(w, "package %s\n", opts.pkg)
+	if len(pkgs) > 0 {
+		fmt.Fprintln(w)
+	}
+	for _, pkg := range slices.Sorted(maps.Keys(pkgs)) {
+		importPath, ok := c.importPaths[pkg]
+		switch {
+		case !ok:
+			fmt.Fprintf(w, "import %q\n", pkg)
+		case path.Base(importPath) != pkg:
+			fmt.Fprintf(w, "import %s %q\n", pkg, importPath)
+		default:
+			fmt.Fprintf(w, "import %q\n", importPath)
+		}
+	}
+
+	for i, r := range reports {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "ghost")
+		fmt.Fprintf(w, "ensures %v == %v\n", r.input, r.value)
+		fmt.Fprintln(w, "decreases")
+		fmt.Fprintf(w, "func lemma%d() {\n", i)
+		body := strings.Builder{}
+		writeAssertions(&body, r.asserts, opts)
+		for _, line := range strings.SplitAfter(body.String(), "\n") {
+			if line != "" {
+				fmt.Fprintf(w, "\t%s", line)
+			}
+		}
+		fmt.Fprintln(w, "}")
+	}
+}
+
+// renameDecls replaces the names of the functions, constants and types e
+// refers to by f(name)
+func renameDecls(e Expr, f func(string) string) Expr {
+	return Rewrite(e, func(e Expr) Expr {
+		switch e := e.(type) {
+		case Call:
+			e.name = f(e.name)
+			return e
+		case Const:
+			e.name = f(e.name)
+			return e
+		case StructLit:
+			e.typ = f(e.typ)
+			return e
+		case SeqLit:
+			if e.typ != nil {
+				e.typ = renameTypes(e.typ, f)
+			}
+			return e
+		case KeyedSeqLit:
+			e.typ = renameTypes(e.typ, f).(TSeq)
+			return e
+		case SetLit:
+			e.typ = renameTypes(e.typ, f)
+			return e
+		case SymLit:
+			e.val.e = renameDecls(e.val.e, f)
+			return e
+		}
+		return e
+	})
+}
+
+func renameTypes(t Type, f func(string) string) Type {
+	switch t := t.(type) {
+	case TAbstract:
+		return TAbstract{f(t.name)}
+	case TSeq:
+		return TSeq{renameTypes(t.elem, f)}
+	case TSet:
+		return TSet{renameTypes(t.elem, f)}
+	case TMset:
+		return TMset{renameTypes(t.elem, f)}
+	case TStruct:
+		fields := make([]StructField, len(t.fields))
+		for i, field := range t.fields {
+			fields[i] = StructField{field.name, renameTypes(field.typ, f)}
+		}
+		return TStruct{fields}
+	}
+	return t
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/antlr4-go/antlr/v4"
+)
+
+type tokenKind int
+
+// the token types of the lexer; tokEOF is the EOF type of the ANTLR runtime
+const (
+	tokEOF   tokenKind = antlr.TokenEOF
+	tokIdent tokenKind = iota
+	tokInt
+	tokChar
+	tokString
+	tokOp
+	tokSemi
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+	col  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokSemi:
+		if t.text == "\n" {
+			return "newline"
+		}
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators, longest first so that the lexer can match greedily. Those the
+// parser does not know only occur in the declarations it skips.
+var operators = []string{
+	"==>", "===", "!==", "...", "<<=", ">>=", "&^=",
+	"++", "==", "!=", "<=", ">=", "&&", "||", ":=", "..",
+	"--", "<<", ">>", "&^", "<-", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=",
+	"+", "-", "*", "/", "%", "#", "<", ">", "!", "=", "&", "|", "^", "~",
+	"(", ")", "[", "]", "{", "}", ",", ":", ".", "?",
+}
+
+// lexer is the token source of the parser's antlr.CommonTokenStream. The
+// tokens of Gobra are simple enough to be matched by hand, so it reads its
+// antlr.CharStream directly instead of running a generated lexer. Like Go, a
+// newline after a token that can end an expression is a semicolon; all other
+// newlines are sent to the hidden channel.
+type lexer struct {
+	*antlr.BaseLexer
+	input antlr.CharStream
+	name  string
+	line  int
+	col   int
+	// the last token sent to the default channel
+	last token
+	// the first malformed token, after which only EOF is emitted
+	err error
+}
+
+func newLexer(input antlr.CharStream, name string) *lexer {
+	return &lexer{BaseLexer: antlr.NewBaseLexer(input), input: input, name: name, line: 1, col: 1}
+}
+
+// NextToken implements antlr.TokenSource
+func (l *lexer) NextToken() antlr.Token {
+	start := l.input.Index()
+	tok := token{tokEOF, "", l.line, l.col}
+	if l.err == nil {
+		var err error
+		if tok, err = l.next(); err != nil {
+			l.err = err
+			tok = token{tokEOF, "", l.line, l.col}
+		}
+	}
+
+	channel := antlr.TokenDefaultChannel
+	switch {
+	case tok.kind == tokSemi && tok.text == "\n" && !l.needsSemi():
+		channel = antlr.TokenHiddenChannel
+	case tok.kind == tokEOF && l.needsSemi():
+		// the EOF is emitted by the next call
+		tok = token{tokSemi, "\n", tok.line, tok.col}
+	}
+	if channel == antlr.TokenDefaultChannel {
+		l.last = tok
+	}
+	// the position and text are given, so the token needs no source; that of
+	// the base lexer would ask its missing ATN simulator for the position
+	source := &antlr.TokenSourceCharStreamPair{}
+	return l.GetTokenFactory().Create(source, int(tok.kind), tok.text, channel, start, l.input.Index()-1, tok.line, tok.col-1)
+}
+
+func (l *lexer) GetLine() int {
+	return l.line
+}
+
+func (l *lexer) GetCharPositionInLine() int {
+	return l.col - 1
+}
+
+func (l *lexer) GetSourceName() string {
+	return l.name
+}
+
+// tokenOf converts a token of the stream back to the parser's view of it
+func tokenOf(t antlr.Token) token {
+	return token{tokenKind(t.GetTokenType()), t.GetText(), t.GetLine(), t.GetColumn() + 1}
+}
+
+func (l *lexer) needsSemi() bool {
+	switch l.last.kind {
+	case tokIdent, tokInt, tokChar, tokString:
+		return true
+	case tokOp:
+		return l.last.text == ")" || l.last.text == "]" || l.last.text == "}"
+	}
+	return false
+}
+
+func (l *lexer) peek(offset int) rune {
+	c := l.input.LA(offset)
+	if c == antlr.TokenEOF {
+		return 0
+	}
+	return rune(c)
+}
+
+func (l *lexer) consume() rune {
+	c := l.peek(1)
+	l.input.Consume()
+	if c == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return c
+}
+
+func (l *lexer) atEOF() bool {
+	return l.input.LA(1) == antlr.TokenEOF
+}
+
+func (l *lexer) errorf(line, col int, format string, args ...any) error {
+	return &parseError{l.name, line, col, fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) next() (token, error) {
+	for !l.atEOF() {
+		c := l.peek(1)
+		switch {
+		case c == '\n':
+			line, col := l.line, l.col
+			l.consume()
+			return token{tokSemi, "\n", line, col}, nil
+		case unicode.IsSpace(c):
+			l.consume()
+		case c == '/' && l.peek(2) == '/':
+			for !l.atEOF() && l.peek(1) != '\n' {
+				l.consume()
+			}
+		case c == '/' && l.peek(2) == '*':
+			line, col := l.line, l.col
+			newline := false
+			l.consume()
+			l.consume()
+			for !(l.peek(1) == '*' && l.peek(2) == '/') {
+				if l.atEOF() {
+					return token{}, l.errorf(line, col, "unterminated comment")
+				}
+				if l.consume() == '\n' {
+					newline = true
+				}
+			}
+			l.consume()
+			l.consume()
+			if newline {
+				return token{tokSemi, "\n", line, col}, nil
+			}
+		default:
+			return l.token()
+		}
+	}
+	return token{tokEOF, "", l.line, l.col}, nil
+}
+
+func (l *lexer) token() (token, error) {
+	line, col := l.line, l.col
+	start := l.input.Index()
+	text := func() string {
+		return l.input.GetText(start, l.input.Index()-1)
+	}
+
+	c := l.peek(1)
+	switch {
+	case c == '_' || unicode.IsLetter(c):
+		for c := l.peek(1); c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c); c = l.peek(1) {
+			l.consume()
+		}
+		return token{tokIdent, text(), line, col}, nil
+	case unicode.IsDigit(c):
+		for c := l.peek(1); c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c); c = l.peek(1) {
+			l.consume()
+		}
+		return token{tokInt, text(), line, col}, nil
+	case c == '`':
+		l.consume()
+		for l.peek(1) != '`' {
+			if l.atEOF() {
+				return token{}, l.errorf(line, col, "unterminated literal")
+			}
+			l.consume()
+		}
+		l.consume()
+		return token{tokString, text(), line, col}, nil
+	case c == '\'' || c == '"':
+		l.consume()
+		for l.peek(1) != c {
+			if l.atEOF() || l.peek(1) == '\n' {
+				return token{}, l.errorf(line, col, "unterminated literal")
+			}
+			if l.consume() == '\\' {
+				l.consume()
+			}
+		}
+		l.consume()
+		if c == '\'' {
+			return token{tokChar, text(), line, col}, nil
+		}
+		return token{tokString, text(), line, col}, nil
+	case c == ';':
+		l.consume()
+		return token{tokSemi, ";", line, col}, nil
+	}
+
+	for _, op := range operators {
+		if l.lookingAt(op) {
+			for range op {
+				l.consume()
+			}
+			return token{tokOp, op, line, col}, nil
+		}
+	}
+
+	return token{}, l.errorf(line, col, "unexpected character %q", c)
+}
+
+func (l *lexer) lookingAt(s string) bool {
+	for i, c := range []rune(s) {
+		if l.peek(i+1) != c {
+			return false
+		}
+	}
+	return true
+}
+
+func parseIntLit(t token) (int, error) {
+	v, err := strconv.ParseInt(strings.ReplaceAll(t.text, "_", ""), 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer literal %s", t.text)
+	}
+	return int(v), nil
+}
+
+func parseCharLit(t token) (int, error) {
+	body := t.text[1 : len(t.text)-1]
+	v, _, tail, err := strconv.UnquoteChar(body, '\'')
+	if err != nil || tail != "" {
+		return 0, fmt.Errorf("invalid character literal %s", t.text)
+	}
+	return int(v), nil
+}
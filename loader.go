@@ -0,0 +1,537 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var builtins = []string{"len", "set", "mset"}
+
+type Package struct {
+	name  string
+	dirs  []string
+	files []*File
+	decls map[string]bool
+	// the subset of decls that are constants
+	consts map[string]bool
+}
+
+// qualify returns the name under which the declaration name of pkg is known
+// in the context. Declarations of the main package stay unqualified.
+func (pkg *Package) qualify(name string) string {
+	if pkg.name == "main" {
+		return name
+	}
+	return pkg.name + "." + name
+}
+
+type Loader struct {
+	// directories searched for imported packages, like Gobra's -I flag
+	includes []string
+}
+
+// Load loads the given .gobra and .go files and directories, groups them by
+// their package clause and resolves all names before building the context.
+// Imported packages that are not among the files are looked up in the include
+// directories and then in the bundled stubs.
+func (l Loader) Load(paths ...string) (Ctx, error) {
+	files, err := collectFiles(paths)
+	if err != nil {
+		return Ctx{}, err
+	}
+	return l.build(files)
+}
+
+// LoadStubs loads every package of the bundled stubs
+func (l Loader) LoadStubs() (Ctx, error) {
+	files, err := stubFiles(".")
+	if err != nil {
+		return Ctx{}, err
+	}
+	return l.build(files)
+}
+
+// loadSources loads the given paths, or the bundled stubs if there are none
+func (l Loader) loadSources(paths []string) (Ctx, error) {
+	if len(paths) == 0 {
+		return l.LoadStubs()
+	}
+	return l.Load(paths...)
+}
+
+func (l Loader) build(files []*File) (Ctx, error) {
+	pkgs, err := addPackages(nil, files)
+	if err != nil {
+		return Ctx{}, err
+	}
+	pkgs, err = l.loadImports(pkgs)
+	if err != nil {
+		return Ctx{}, err
+	}
+
+	importPaths := make(map[string]string)
+	fns := []Func{}
+	types := []TypeDecl{}
+	consts := []ConstDecl{}
+	errs := []error{}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.files {
+			for _, imp := range f.imports {
+				target, err := findPackage(imp.path, pkgs)
+				if err != nil {
+					continue
+				}
+				if _, ok := importPaths[target.name]; !ok {
+					importPaths[target.name] = imp.path
+				}
+			}
+			r, err := newResolver(pkg, f, pkgs)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			fns = append(fns, r.funcs()...)
+			types = append(types, r.types()...)
+			consts = append(consts, r.consts()...)
+			errs = append(errs, r.errs...)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Ctx{}, err
+	}
+
+	c := EmptyCtx().WithTypes(types)
+	if err := c.checkTypeDecls(); err != nil {
+		return Ctx{}, err
+	}
+	for i, t := range types {
+		types[i].typ = c.resolveType(t.typ)
+	}
+	for i, fn := range fns {
+		fns[i] = c.resolveFunc(fn)
+	}
+	for i, d := range consts {
+		if d.typ != nil {
+			consts[i].typ = c.resolveType(d.typ)
+		}
+		consts[i].value = c.resolveExpr(d.value)
+	}
+	c = EmptyCtx().WithTypes(types).WithConsts(consts).WithFunctions(fns)
+	c.importPaths = importPaths
+	return c, c.checkTypes()
+}
+
+// loadImports adds the packages imported by pkgs, and transitively the
+// packages they import, that were not loaded yet
+func (l Loader) loadImports(pkgs []*Package) ([]*Package, error) {
+	for i := 0; i < len(pkgs); i++ {
+		for _, f := range pkgs[i].files {
+			for _, imp := range f.imports {
+				if _, err := findPackage(imp.path, pkgs); err == nil {
+					continue
+				}
+				files, err := l.findImport(imp.path)
+				if err != nil {
+					return nil, err
+				}
+				// packages that cannot be found are reported by the resolver
+				if len(files) == 0 {
+					continue
+				}
+				pkgs, err = addPackages(pkgs, files)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return pkgs, nil
+}
+
+// findImport returns the files of the package with the given import path,
+// searching the include directories before the bundled stubs
+func (l Loader) findImport(path string) ([]*File, error) {
+	for _, dir := range l.includes {
+		dir = filepath.Join(dir, filepath.FromSlash(path))
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return collectFiles([]string{dir})
+		}
+	}
+	return stubFiles(path)
+}
+
+func collectFiles(paths []string) ([]*File, error) {
+	files := []*File{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		names := []string{path}
+		if info.IsDir() {
+			names, err = sourceFiles(path)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, name := range names {
+			load := loadFile
+			if filepath.Ext(name) == ".go" {
+				load = loadGoFile
+			}
+			f, err := load(name)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// sourceFiles lists the .gobra and .go files of a directory. Test files are
+// skipped.
+func sourceFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if ext := filepath.Ext(name); ext == ".gobra" || ext == ".go" {
+			names = append(names, filepath.Join(dir, name))
+		}
+	}
+	return names, nil
+}
+
+// addPackages groups files by their package clause and adds them to pkgs
+func addPackages(pkgs []*Package, files []*File) ([]*Package, error) {
+	byName := make(map[string]*Package)
+	for _, pkg := range pkgs {
+		byName[pkg.name] = pkg
+	}
+	errs := []error{}
+
+	for _, f := range files {
+		pkg, ok := byName[f.pkg]
+		if !ok {
+			pkg = &Package{name: f.pkg, decls: make(map[string]bool), consts: make(map[string]bool)}
+			byName[f.pkg] = pkg
+			pkgs = append(pkgs, pkg)
+		}
+		pkg.files = append(pkg.files, f)
+		if dir := filepath.Dir(f.name); !slices.Contains(pkg.dirs, dir) {
+			pkg.dirs = append(pkg.dirs, dir)
+		}
+
+		declare := func(name string) {
+			if pkg.decls[name] {
+				errs = append(errs, fmt.Errorf("%s: %s redeclared in package %s", f.name, name, pkg.name))
+			}
+			pkg.decls[name] = true
+		}
+		for _, fn := range f.funcs {
+			declare(fn.Name)
+		}
+		for _, t := range f.types {
+			declare(t.name)
+		}
+		for _, d := range f.consts {
+			declare(d.name)
+			pkg.consts[d.name] = true
+		}
+	}
+
+	return pkgs, errors.Join(errs...)
+}
+
+// findPackage returns the package an import path refers to. A package matches
+// if one of its directories ends in the import path or, failing that, if its
+// name is the last element of the import path.
+func findPackage(path string, pkgs []*Package) (*Package, error) {
+	matches := []*Package{}
+	for _, pkg := range pkgs {
+		for _, dir := range pkg.dirs {
+			dir = filepath.ToSlash(dir)
+			if dir == path || strings.HasSuffix(dir, "/"+path) {
+				matches = append(matches, pkg)
+				break
+			}
+		}
+	}
+	if len(matches) == 0 {
+		for _, pkg := range pkgs {
+			if pkg.name == filepath.Base(path) {
+				matches = append(matches, pkg)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("cannot find package %q", path)
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("import path %q is ambiguous", path)
+}
+
+type resolver struct {
+	pkg     *Package
+	file    *File
+	imports map[string]*Package
+	dots    []*Package
+	errs    []error
+}
+
+func newResolver(pkg *Package, f *File, pkgs []*Package) (*resolver, error) {
+	r := &resolver{pkg: pkg, file: f, imports: make(map[string]*Package)}
+	errs := []error{}
+
+	for _, imp := range f.imports {
+		target, err := findPackage(imp.path, pkgs)
+		if err != nil {
+			if !imp.optional {
+				errs = append(errs, errors.New(posf(imp.pos, "%v", err)))
+			}
+			continue
+		}
+		switch imp.alias {
+		case "_":
+		case ".":
+			r.dots = append(r.dots, target)
+		default:
+			alias := imp.alias
+			if alias == "" {
+				alias = target.name
+			}
+			if _, ok := r.imports[alias]; ok {
+				errs = append(errs, errors.New(posf(imp.pos, "%s imported more than once", alias)))
+			}
+			r.imports[alias] = target
+		}
+	}
+
+	return r, errors.Join(errs...)
+}
+
+func (r *resolver) errorf(pos Pos, format string, args ...any) {
+	if !pos.IsValid() {
+		r.errs = append(r.errs, fmt.Errorf("%s: %s", r.file.name, fmt.Sprintf(format, args...)))
+		return
+	}
+	r.errs = append(r.errs, errors.New(posf(pos, format, args...)))
+}
+
+// resolve returns the qualified name of the declaration name refers to
+func (r *resolver) resolve(name string, pos Pos) string {
+	if alias, decl, ok := strings.Cut(name, "."); ok {
+		pkg, ok := r.imports[alias]
+		if !ok || !pkg.decls[decl] {
+			r.errorf(pos, "undefined: %s", name)
+			return name
+		}
+		return pkg.qualify(decl)
+	}
+
+	candidates := []*Package{}
+	for _, pkg := range append([]*Package{r.pkg}, r.dots...) {
+		if pkg.decls[name] {
+			candidates = append(candidates, pkg)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		if !slices.Contains(builtins, name) {
+			r.errorf(pos, "undefined: %s", name)
+		}
+		return name
+	case 1:
+		return candidates[0].qualify(name)
+	}
+	r.errorf(pos, "%s is ambiguous", name)
+	return name
+}
+
+func (r *resolver) typ(t Type, pos Pos) Type {
+	switch t := t.(type) {
+	case TAbstract:
+		return TAbstract{r.resolve(t.name, pos)}
+	case TSeq:
+		return TSeq{r.typ(t.elem, pos)}
+	case TSet:
+		return TSet{r.typ(t.elem, pos)}
+	case TMset:
+		return TMset{r.typ(t.elem, pos)}
+	case TStruct:
+		fields := make([]StructField, len(t.fields))
+		for i, f := range t.fields {
+			fields[i] = StructField{f.name, r.typ(f.typ, pos)}
+		}
+		return TStruct{fields}
+	}
+	return t
+}
+
+func (r *resolver) typs(ts []Type, pos Pos) []Type {
+	res := make([]Type, len(ts))
+	for i, t := range ts {
+		res[i] = r.typ(t, pos)
+	}
+	return res
+}
+
+// constant returns the qualified name of the constant name refers to, if it
+// refers to one
+func (r *resolver) constant(name string) (string, bool) {
+	if alias, decl, ok := strings.Cut(name, "."); ok {
+		pkg, ok := r.imports[alias]
+		if !ok || !pkg.consts[decl] {
+			return "", false
+		}
+		return pkg.qualify(decl), true
+	}
+	for _, pkg := range append([]*Package{r.pkg}, r.dots...) {
+		if pkg.consts[name] {
+			return r.resolve(name, Pos{}), true
+		}
+	}
+	return "", false
+}
+
+// expr resolves the names in e. Variables that are not bound by the
+// enclosing function must refer to constants.
+func (r *resolver) expr(e Expr, bound []string) Expr {
+	return RewriteScoped(e, bound, func(e Expr, bound []string) Expr {
+		switch e := e.(type) {
+		case Var:
+			if slices.Contains(bound, e.Name) {
+				return e
+			}
+			if name, ok := r.constant(e.Name); ok {
+				return Const{name, e.pos}
+			}
+			r.errorf(e.pos, "undefined: %s", e.Name)
+			return e
+		case FieldAccess:
+			pkg, ok := e.lhs.(Var)
+			if !ok || slices.Contains(bound, pkg.Name) {
+				return e
+			}
+			if _, ok := r.imports[pkg.Name]; !ok {
+				return e
+			}
+			name := pkg.Name + "." + e.field
+			if qualified, ok := r.constant(name); ok {
+				return Const{qualified, e.pos}
+			}
+			r.errorf(e.pos, "undefined: %s", name)
+			return e
+		case Call:
+			e.name = r.resolve(e.name, e.pos)
+			return e
+		case StructLit:
+			e.typ = r.resolve(e.typ, e.pos)
+			return e
+		case SeqLit:
+			if e.typ != nil {
+				e.typ = r.typ(e.typ, e.pos)
+			}
+			return e
+		case KeyedSeqLit:
+			e.typ = r.typ(e.typ, e.pos).(TSeq)
+			return e
+		case SetLit:
+			e.typ = r.typ(e.typ, e.pos)
+			return e
+		case ElidedLit:
+			if e.typ != nil {
+				e.typ = r.typ(e.typ, e.pos)
+			}
+			return e
+		}
+		return e
+	})
+}
+
+func (r *resolver) exprs(es []Expr, bound []string) []Expr {
+	if es == nil {
+		return nil
+	}
+	res := make([]Expr, len(es))
+	for i, e := range es {
+		res[i] = r.expr(e, bound)
+	}
+	return res
+}
+
+func (r *resolver) funcs() []Func {
+	res := make([]Func, len(r.file.funcs))
+	for i, fn := range r.file.funcs {
+		fn.Name = r.pkg.qualify(fn.Name)
+		fn.argtypes = r.typs(fn.argtypes, fn.pos)
+		if fn.rettyp != nil {
+			fn.rettyp = r.typ(fn.rettyp, fn.pos)
+		}
+		if fn.body != nil {
+			fn.body = r.expr(fn.body, fn.vars)
+		}
+		fn.requires = r.exprs(fn.requires, fn.vars)
+		fn.ensures = r.exprs(fn.ensures, append(slices.Clip(fn.vars), fn.result))
+		// decreases _ is a wildcard measure
+		fn.decreases = r.exprs(fn.decreases, append(slices.Clip(fn.vars), "_"))
+		res[i] = fn
+	}
+	return res
+}
+
+func (r *resolver) consts() []ConstDecl {
+	res := make([]ConstDecl, len(r.file.consts))
+	for i, d := range r.file.consts {
+		d.name = r.pkg.qualify(d.name)
+		if d.typ != nil {
+			d.typ = r.typ(d.typ, d.pos)
+		}
+		d.value = r.expr(d.value, nil)
+		res[i] = d
+	}
+	return res
+}
+
+func (r *resolver) types() []TypeDecl {
+	res := make([]TypeDecl, len(r.file.types))
+	for i, t := range r.file.types {
+		res[i] = TypeDecl{r.pkg.qualify(t.name), r.typ(t.typ, t.pos), t.alias, t.pos}
+	}
+	return res
+}
+
+// resolveInput resolves the names in an expression given on the command line.
+// Such expressions refer to declarations by their qualified names.
+func (c *Ctx) resolveInput(e Expr) Expr {
+	return c.resolveExpr(RewriteScoped(e, nil, func(e Expr, bound []string) Expr {
+		name, ok := calleeName(e)
+		if !ok {
+			return e
+		}
+		if root, _, _ := strings.Cut(name, "."); slices.Contains(bound, root) {
+			return e
+		}
+		if _, ok := c.consts[name]; ok {
+			return Const{name, e.Pos()}
+		}
+		return e
+	}))
+}
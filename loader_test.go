@@ -0,0 +1,39 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/antlr4-go/antlr/v4"
+)
+
+const undefinedSrc = `package main
+
+const c = 1
+
+ghost
+requires b > 0
+decreases _
+pure func f(a int) int {
+	return let x := a in x + c + qq
+}
+`
+
+func TestUndefinedVars(t *testing.T) {
+	f, err := parseFile(antlr.NewInputStream(undefinedSrc), "undefined.gobra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Loader{}.build([]*File{f})
+	if err == nil {
+		t.Fatal("got no error, want the undefined b and qq")
+	}
+	want := []string{
+		"undefined.gobra:9:31: undefined: qq",
+		"undefined.gobra:6:10: undefined: b",
+	}
+	if got := strings.Split(err.Error(), "\n"); !slices.Equal(got, want) {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+}
@@ -2,8 +2,9 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"slices"
 	"strings"
-	"unicode/utf8"
 )
 
 type binop int
@@ -21,6 +22,25 @@ const (
 	gt
 	lt
 	and
+	or
+	neq
+	leq
+	geq
+	mod
+	implies
+	in
+	union
+	intersection
+	setminus
+	subset
+	multiplicity
+)
+
+type unop int
+
+const (
+	not unop = iota
+	neg
 )
 
 func assert(b bool, reason ...string) {
@@ -42,6 +62,11 @@ func Walk(v Visitor, expr Expr) {
 	case Binop:
 		Walk(v, e.l)
 		Walk(v, e.r)
+	case Unop:
+		Walk(v, e.e)
+	case Let:
+		Walk(v, e.value)
+		Walk(v, e.body)
 	case Ternop:
 		Walk(v, e.cond)
 		Walk(v, e.yes)
@@ -58,6 +83,10 @@ func Walk(v Visitor, expr Expr) {
 		for _, arg := range e.args {
 			Walk(v, arg)
 		}
+	case SetLit:
+		for _, arg := range e.args {
+			Walk(v, arg)
+		}
 	case SeqIndex:
 		Walk(v, e.s)
 		Walk(v, e.i)
@@ -65,17 +94,144 @@ func Walk(v Visitor, expr Expr) {
 		Walk(v, e.s)
 		Walk(v, e.low)
 		Walk(v, e.high)
+	case SeqRange:
+		Walk(v, e.low)
+		Walk(v, e.high)
+	case SeqUpdate:
+		Walk(v, e.s)
+		Walk(v, e.i)
+		Walk(v, e.v)
+	case KeyedSeqLit:
+		for i, arg := range e.args {
+			Walk(v, e.keys[i])
+			Walk(v, arg)
+		}
+	case ElidedLit:
+		for i, arg := range e.args {
+			Walk(v, e.keys[i])
+			Walk(v, arg)
+		}
+		for _, ex := range e.fields {
+			Walk(v, ex)
+		}
+	case FieldAccess:
+		Walk(v, e.lhs)
+
+	}
+}
 
+func mapAll(exprs []Expr, f func(Expr) Expr) []Expr {
+	res := make([]Expr, len(exprs))
+	for i, e := range exprs {
+		res[i] = f(e)
 	}
+	return res
+}
+
+// mapChildren rebuilds expr with every direct child c replaced by f(c)
+func mapChildren(expr Expr, f func(Expr) Expr) Expr {
+	switch e := expr.(type) {
+	case Binop:
+		expr = Binop{e.opcode, f(e.l), f(e.r), e.pos}
+	case Unop:
+		expr = Unop{e.opcode, f(e.e), e.pos}
+	case Ternop:
+		expr = Ternop{f(e.cond), f(e.yes), f(e.no), e.pos}
+	case Let:
+		expr = Let{e.name, f(e.value), f(e.body), e.pos}
+	case Call:
+		e.args = mapAll(e.args, f)
+		expr = e
+	case StructLit:
+		fields := make(map[string]Expr)
+		for k, ex := range e.fields {
+			fields[k] = f(ex)
+		}
+		expr = StructLit{e.typ, fields, e.pos}
+	case SeqLit:
+		expr = SeqLit{e.typ, mapAll(e.args, f), e.pos}
+	case SetLit:
+		expr = SetLit{e.typ, mapAll(e.args, f), e.pos}
+	case SeqIndex:
+		expr = SeqIndex{f(e.s), f(e.i), e.pos}
+	case SeqSlice:
+		expr = SeqSlice{f(e.s), f(e.low), f(e.high), e.pos}
+	case SeqRange:
+		expr = SeqRange{f(e.low), f(e.high), e.pos}
+	case SeqUpdate:
+		expr = SeqUpdate{f(e.s), f(e.i), f(e.v), e.pos}
+	case KeyedSeqLit:
+		keys := make([]Expr, len(e.keys))
+		for i, key := range e.keys {
+			if key != nil {
+				keys[i] = f(key)
+			}
+		}
+		expr = KeyedSeqLit{e.typ, keys, mapAll(e.args, f), e.pos}
+	case ElidedLit:
+		keys := make([]Expr, len(e.keys))
+		for i, key := range e.keys {
+			if key != nil {
+				keys[i] = f(key)
+			}
+		}
+		var fields map[string]Expr
+		if e.fields != nil {
+			fields = make(map[string]Expr)
+			for k, ex := range e.fields {
+				fields[k] = f(ex)
+			}
+		}
+		expr = ElidedLit{e.typ, keys, mapAll(e.args, f), fields, e.pos}
+	case FieldAccess:
+		expr = FieldAccess{f(e.lhs), e.field, e.pos}
+	}
+	return expr
+}
+
+// Rewrite rebuilds expr bottom up, replacing every node n with f(n)
+func Rewrite(expr Expr, f func(Expr) Expr) Expr {
+	if expr == nil {
+		return nil
+	}
+	return f(mapChildren(expr, func(e Expr) Expr { return Rewrite(e, f) }))
+}
+
+// RewriteScoped is Rewrite for functions that depend on the variables in
+// scope. f is passed the names in bound together with the names bound by the
+// let expressions around the node, innermost last.
+func RewriteScoped(expr Expr, bound []string, f func(e Expr, bound []string) Expr) Expr {
+	if expr == nil {
+		return nil
+	}
+	if e, ok := expr.(Let); ok {
+		e.value = RewriteScoped(e.value, bound, f)
+		e.body = RewriteScoped(e.body, append(slices.Clip(bound), e.name), f)
+		return f(e, bound)
+	}
+	return f(mapChildren(expr, func(e Expr) Expr { return RewriteScoped(e, bound, f) }), bound)
+}
+
+// freeVars returns the names of the variables of e that are not bound by a
+// let expression in e
+func freeVars(e Expr) map[string]bool {
+	free := map[string]bool{}
+	RewriteScoped(e, nil, func(e Expr, bound []string) Expr {
+		if x, ok := e.(Var); ok && !slices.Contains(bound, x.Name) {
+			free[x.Name] = true
+		}
+		return e
+	})
+	return free
 }
 
 func evalBinop(op binop, l, r Val) Val {
 
 	if _, ok := l.(SymVal); ok {
-		return SymVal{Binop{op, lit(l), lit(r)}}
+		return SymVal{binary(op, lit(l), lit(r))}
 	}
 	if _, ok := r.(SymVal); ok {
-		return SymVal{Binop{op, lit(l), lit(r)}}
+		return SymVal{binary(op, lit(l), lit(r))}
 	}
 
 	li, lint := l.(Int)
@@ -95,35 +251,106 @@ func evalBinop(op binop, l, r Val) Val {
 	case div:
 		assert(lint && rint)
 		return Int{li.val / ri.val}
+	case mod:
+		assert(lint && rint)
+		return Int{li.val % ri.val}
 	case concat:
 		assert(lseq && rseq)
 		return Seq{ls.typ, append(ls.elems, rs.elems...)}
 	case eqeq:
 		return Bool{l.Equals(r)}
+	case neq:
+		return Bool{!l.Equals(r)}
 	case lt:
 		return Bool{asInt(l) < asInt(r)}
 	case gt:
 		return Bool{asInt(l) > asInt(r)}
+	case leq:
+		return Bool{asInt(l) <= asInt(r)}
+	case geq:
+		return Bool{asInt(l) >= asInt(r)}
 	case and:
 		return Bool{asBool(l) && asBool(r)}
+	case or:
+		return Bool{asBool(l) || asBool(r)}
+	case implies:
+		return Bool{!asBool(l) || asBool(r)}
+	case in:
+		if rset, ok := r.(Set); ok {
+			return Bool{rset.contains(l)}
+		}
+		if rm, ok := r.(Mset); ok {
+			return Bool{rm.count(l) > 0}
+		}
+		assert(rseq)
+		return Bool{slices.ContainsFunc(rs.elems, l.Equals)}
+	case multiplicity:
+		return Int{asMset(r).count(l)}
+	case union:
+		if lm, ok := l.(Mset); ok {
+			return lm.union(asMset(r))
+		}
+		lset, rset := asSet(l), asSet(r)
+		return newSet(lset.typ, append(slices.Clone(lset.elems), rset.elems...))
+	case intersection:
+		if lm, ok := l.(Mset); ok {
+			return lm.intersection(asMset(r))
+		}
+		lset, rset := asSet(l), asSet(r)
+		return newSet(lset.typ, slices.DeleteFunc(slices.Clone(lset.elems), func(v Val) bool { return !rset.contains(v) }))
+	case setminus:
+		if lm, ok := l.(Mset); ok {
+			return lm.setminus(asMset(r))
+		}
+		lset, rset := asSet(l), asSet(r)
+		return newSet(lset.typ, slices.DeleteFunc(slices.Clone(lset.elems), rset.contains))
+	case subset:
+		if lm, ok := l.(Mset); ok {
+			return Bool{lm.subset(asMset(r))}
+		}
+		lset, rset := asSet(l), asSet(r)
+		return Bool{!slices.ContainsFunc(lset.elems, func(v Val) bool { return !rset.contains(v) })}
 	default:
 		panic("unsupported binop")
 	}
 }
 
+func evalUnop(op unop, v Val) Val {
+	if _, ok := v.(SymVal); ok {
+		return SymVal{unary(op, lit(v))}
+	}
+
+	switch op {
+	case not:
+		return Bool{!asBool(v)}
+	case neg:
+		return Int{-asInt(v)}
+	default:
+		panic("unsupported unop")
+	}
+}
+
 type Ctx struct {
 	fns           []Func
+	types         map[string]TypeDecl
+	consts        map[string]ConstDecl
+	importPaths   map[string]string // import path of each package, by name
 	callExprs     []Call
 	criticalExprs []Expr
 	critical      Expr
+	redex         Expr // the expression reduced by the last step
 }
 
 func EmptyCtx() Ctx {
 	return Ctx{
 		[]Func{},
+		map[string]TypeDecl{},
+		map[string]ConstDecl{},
+		map[string]string{},
 		[]Call{},
 		[]Expr{},
 		nil,
+		nil,
 	}
 }
 
@@ -132,6 +359,30 @@ func (c Ctx) WithFunctions(f []Func) Ctx {
 	return c
 }
 
+func (c Ctx) WithTypes(decls []TypeDecl) Ctx {
+	types := make(map[string]TypeDecl)
+	for k, v := range c.types {
+		types[k] = v
+	}
+	for _, d := range decls {
+		types[d.name] = d
+	}
+	c.types = types
+	return c
+}
+
+func (c Ctx) WithConsts(decls []ConstDecl) Ctx {
+	consts := make(map[string]ConstDecl)
+	for k, v := range c.consts {
+		consts[k] = v
+	}
+	for _, d := range decls {
+		consts[d.name] = d
+	}
+	c.consts = consts
+	return c
+}
+
 func (c *Ctx) tryGetFn(name string) *Func {
 	for _, f := range c.fns {
 		if f.Name == name {
@@ -142,23 +393,14 @@ func (c *Ctx) tryGetFn(name string) *Func {
 	return nil
 }
 
-func (c *Ctx) getFn(name string) Func {
+func (c *Ctx) getFn(name string, pos Pos) Func {
 	res := c.tryGetFn(name)
 	if res == nil {
-		panic(fmt.Sprintf("function %s not found", name))
+		panic(posf(pos, "function %s not found", name))
 	}
 	return *res
 }
 
-func seqStr(s string) SeqLit {
-	res := make([]Expr, 0)
-	for _, el := range strings.Split(s, "") {
-		codepoint, _ := utf8.DecodeRune([]byte(el))
-		res = append(res, IntLit{int(codepoint)})
-	}
-	return SeqLit{TSeq{tbyte()}, res}
-}
-
 func reduceUntilVal(e Expr, c *Ctx) ([]Expr, Val) {
 	var didStep bool
 	exprs := make([]Expr, 0, 1)
@@ -184,149 +426,120 @@ func reduceUntilVal(e Expr, c *Ctx) ([]Expr, Val) {
 	}
 }
 
-func generateFunctionCallAssertions(e Expr) {
-	w := strings.Builder{}
-	fmt.Fprintf(&w, "// reducing %s \n", e)
-	c := mkCtx()
-	calls, _ := genFnCalls(e, &c)
-
-	for i := len(calls) - 1; i >= 0; i-- {
-		_, v := reduceUntilVal(calls[i], &c)
-		fmt.Fprintf(&w, "assert %s == %s\n", calls[i], lit(v))
-	}
-
-	s := w.String()
-
-	s = rename(s, tseq(tbyte(), IntLit{'/'}), "sep")
-	s = rename(s, seq(tseq(tbyte(), IntLit{'.'}, IntLit{'.'})), "tail")
-	s = rename(s, seqStr("d"), "sep")
-	s = rename(s, seqStr("abcd"), "abcd")
-	s = rename(s, seqStr("abc"), "abc")
-
-	fmt.Println(s)
+// step is one reduction step: the expression it produced, the redex that
+// fired and the critical expression it reached, if any
+type step struct {
+	expr     Expr
+	redex    Expr
+	critical Expr
 }
 
-func genFnCalls(e Expr, c *Ctx) ([]Expr, Val) {
-	var didStep bool
-	calls := make([]Expr, 0)
+// traceSteps records every step of the reduction of e to a value. Critical
+// expressions dropped by f are not recorded.
+func traceSteps(e Expr, c Ctx, f filter) []step {
+	steps := []step{}
 	for {
-		e, didStep = e.Step(c)
-
-		v, ok := e.ToValue()
-		if ok {
-			return calls, v
+		if _, ok := e.ToValue(); ok {
+			return steps
 		}
-
-		if c.critical != nil {
-			calls = append(calls, c.critical)
-		}
-		c.critical = nil
-
+		c.redex, c.critical = nil, nil
+		next, didStep := e.Step(&c)
 		if !didStep {
 			panic("could not make progress but is not value")
 		}
+		e = next
+		if c.critical != nil && !f.keeps(c.critical) {
+			c.critical = nil
+		}
+		steps = append(steps, step{e, c.redex, c.critical})
 	}
-
 }
 
-func evaluatesTo(e Expr, c Ctx) Val {
-	_, v := reduceUntilVal(e, &c)
-	return v
-}
-
-func mkCtx() Ctx {
-
-	return EmptyCtx().WithFunctions([]Func{
-		SpecSplit(),
-		SpecSplitInner(),
-		ToPath(),
-		newPath(),
-		toPath(),
-		pathContents(),
-		isRooted(),
-		pathAppend(),
-		Repeat(),
-	})
-}
+// granularity selects which events of a reduction are asserted
+type granularity int
 
-func generateLikelyAssertions(exp Expr) {
+const (
+	// the granularity of the command being run
+	defaultGranularity granularity = iota
+	// every reduction step
+	stepGranularity
+	// every call of a function
+	callGranularity
+	// the calls that enter a function from another one: the calls of the input
+	// and the first call of each recursion, without the recursive calls
+	toplevelGranularity
+	// every critical event: function calls and slices
+	criticalGranularity
+)
 
-	c := mkCtx()
+var granularities = []string{
+	stepGranularity:     "step",
+	callGranularity:     "call",
+	toplevelGranularity: "toplevel",
+	criticalGranularity: "critical",
+}
 
-	for _, fn := range c.fns {
-		fmt.Printf("%s: %v\n", fn.Name, fn.body)
+func parseGranularity(s string) (granularity, error) {
+	if i := slices.Index(granularities, s); i > 0 {
+		return granularity(i), nil
 	}
+	return 0, fmt.Errorf("unknown granularity %q, expected one of %s", s, strings.Join(granularities[1:], ", "))
+}
 
-	// fmt.Printf("exp: %v\n", exp)
-	// exp = exp.Step(&c)
-	// fmt.Printf("exp: %v\n", exp)
-
-	intermediate, val := reduceUntilVal(exp, &c)
-	fmt.Printf("val: %v\n", lit(val))
-
-	// fmt.Println()
-	// for _, callExpr := range c.callExprs {
-	// 	v := evaluatesTo(callExpr, c)
-	// 	fmt.Printf("assert %v == %v\n", callExpr, lit(v))
-	// }
-
-	fmt.Println()
-	for _, e := range c.criticalExprs {
-		v := evaluatesTo(e, c)
-		fmt.Printf("assert %v == %v\n", e, lit(v))
+// selects reports whether a critical event is asserted at granularity g
+func (g granularity) selects(critical Expr) bool {
+	call, isCall := critical.(Call)
+	switch g {
+	case callGranularity:
+		return isCall
+	case toplevelGranularity:
+		return isCall && call.caller != call.name
 	}
+	return true
+}
 
-	fmt.Println()
-	fmt.Println()
-	fmt.Println()
-	fmt.Println()
-	fmt.Println()
-	fmt.Println()
+// generateAssertions reduces e to a value and asserts the events selected by
+// g and kept by f. Steps, which f does not apply to, are asserted as
+// equalities between consecutive expressions, in order. Critical events are
+// asserted to equal their value, innermost first, so that each assertion can
+// rely on the ones before it.
+func generateAssertions(c Ctx, e Expr, g granularity, f filter) report {
+	steps := traceSteps(e, c, f)
+	last := e
+	if len(steps) > 0 {
+		last = steps[len(steps)-1].expr
+	}
+	v, _ := last.ToValue()
+	val := lit(v)
+
+	asserts := []assertion{}
+	if g == stepGranularity {
+		prev := e
+		for _, s := range steps[:max(len(steps)-1, 0)] {
+			asserts = append(asserts, assertion{prev, s.expr})
+			prev = s.expr
+		}
+		if len(steps) > 0 {
+			asserts = append(asserts, assertion{prev, val})
+		}
+		return report{input: e, asserts: asserts, value: val}
+	}
 
-	for i := 0; i < len(intermediate)-1; i++ {
-		fmt.Printf("assert %v == %v\n", intermediate[i], intermediate[i+1])
+	for i := len(steps) - 1; i >= 0; i-- {
+		critical := steps[i].critical
+		if critical == nil || !g.selects(critical) {
+			continue
+		}
+		asserts = append(asserts, assertion{critical, lit(evaluatesTo(critical, c))})
 	}
+	return report{input: e, asserts: asserts, value: val}
 }
 
-func rename(src string, e Expr, v string) string {
-	return strings.ReplaceAll(src, e.String(), v)
+func evaluatesTo(e Expr, c Ctx) Val {
+	_, v := reduceUntilVal(e, &c)
+	return v
 }
 
 func main() {
-
-	s := seqStr("a,b")
-	sep := seqStr(",")
-
-	fmt.Printf("s: %v\n", s.String())
-	fmt.Printf("sep: %v\n", sep.String())
-
-	fmt.Printf("newPath(): %v\n", newPath().body)
-	// fmt.Printf("c: %v\n", c)
-
-	println()
-	println()
-	println()
-
-	sep = seqStr("/")
-
-	fmt.Println(SpecSplitInner().body)
-
-	// generateLikelyAssertions(call("bytes.SpecSplit", s, sep))
-	// generateLikelyAssertions(call("ToPath", tseq(tbyte())))
-	// generateLikelyAssertions(call("ToPath", tseq(tbyte(), IntLit{'/'}, IntLit{'a'})))
-	// generateLikelyAssertions(call("ToPath", tseq(tbyte(), IntLit{'.'})))
-	// generateFunctionCallAssertions(call("ToPath", tseq(tbyte(), IntLit{'.'})))
-	// generateFunctionCallAssertions(call("ToPath", tseq(tbyte())))
-	// generateFunctionCallAssertions(call("bytes.SpecSplitInner", tseq(tbyte(), IntLit{'.'}, IntLit{'.'}), tseq(tbyte(), IntLit{'/'}), tseq(tbyte())))
-	// generateFunctionCallAssertions(call("bytes.SpecSplit", seqStr("abcd"), tseq(tbyte(), IntLit{'a'})))
-	generateFunctionCallAssertions(call("bytes.Repeat", seqStr("ab"), IntLit{2}))
-	generateFunctionCallAssertions(call("bytes.Repeat", seqStr("ab"), IntLit{0}))
-	generateFunctionCallAssertions(call("bytes.Repeat", seqStr("a"), IntLit{4}))
-	generateFunctionCallAssertions(call("bytes.SpecSplit", seqStr("abcd"), tseq(tbyte(), IntLit{'d'})))
-	generateFunctionCallAssertions(call("bytes.SpecSplit", seqStr(""), tseq(tbyte(), IntLit{'/'})))
-	generateFunctionCallAssertions(call("bytes.SpecSplitInner", seqStr("c/"), tseq(tbyte(), IntLit{'/'}), tseq(tbyte(), IntLit{'-'})))
-	generateFunctionCallAssertions(call("bytes.SpecSplitInner", seqStr("c/"), tseq(tbyte(), IntLit{'/'}), v("ac")))
-	// generateFunctionCallAssertions(call("bytes.SpecSplitInner", seqStr("/"), tseq(tbyte(), IntLit{'/'}), v("ac")))
-	// generateFunctionCallAssertions(call("bytes.SpecSplitInner", sep, sep, v("ac")))
-	// expr :=
+	os.Exit(run(os.Args[1:]))
 }
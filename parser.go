@@ -0,0 +1,849 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/antlr4-go/antlr/v4"
+)
+
+type parseError struct {
+	file string
+	line int
+	col  int
+	msg  string
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.file, e.line, e.col, e.msg)
+}
+
+type Import struct {
+	alias string
+	path  string
+	// optional imports may refer to packages without specifications, such
+	// as the imports of Go files
+	optional bool
+	pos      Pos
+}
+
+type File struct {
+	name    string
+	pkg     string
+	imports []Import
+	types   []TypeDecl
+	consts  []ConstDecl
+	funcs   []Func
+}
+
+// parser is a recursive-descent parser over the token stream of the lexer,
+// for the subset of Gobra the interpreter evaluates: package and import
+// clauses, type and constant declarations and pure functions. Other
+// declarations are skipped.
+type parser struct {
+	name string
+	toks *antlr.CommonTokenStream
+	// in ends the expression instead of testing membership, as in the value
+	// of a let binding
+	inEnds bool
+}
+
+func newParser(input antlr.CharStream, name string) (*parser, error) {
+	l := newLexer(input, name)
+	toks := antlr.NewCommonTokenStream(l, antlr.TokenDefaultChannel)
+	toks.Fill()
+	if l.err != nil {
+		return nil, l.err
+	}
+	return &parser{name: name, toks: toks}, nil
+}
+
+func loadFile(path string) (*File, error) {
+	input, err := antlr.NewFileStream(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseFile(input, path)
+}
+
+func parseFile(input antlr.CharStream, name string) (f *File, err error) {
+	p, err := newParser(input, name)
+	if err != nil {
+		return nil, err
+	}
+	defer p.recover(&err)
+
+	return p.file(), nil
+}
+
+// parseExpr parses a single Gobra expression such as a call typed on the
+// command line
+func parseExpr(src string) (Expr, error) {
+	return parseExprAt(src, "<input>", 1)
+}
+
+// parseExprAt parses an expression that starts on the given line of file
+func parseExprAt(src string, file string, line int) (e Expr, err error) {
+	src = strings.Repeat("\n", line-1) + src
+	p, err := newParser(antlr.NewInputStream(src), file)
+	if err != nil {
+		return nil, err
+	}
+	defer p.recover(&err)
+
+	e = p.expr()
+	p.skipSemis()
+	if t := p.peek(); t.kind != tokEOF {
+		p.errorf(t, "unexpected %v after expression", t)
+	}
+	return e, nil
+}
+
+// recover turns a parseError raised by one of the parse functions into an
+// ordinary error
+func (p *parser) recover(err *error) {
+	if r := recover(); r != nil {
+		perr, ok := r.(*parseError)
+		if !ok {
+			panic(r)
+		}
+		*err = perr
+	}
+}
+
+func (p *parser) peek() token {
+	return p.lookahead(1)
+}
+
+// lookahead returns the kth token from the current one, which is the first
+func (p *parser) lookahead(k int) token {
+	return tokenOf(p.toks.LT(k))
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if t.kind != tokEOF {
+		p.toks.Consume()
+	}
+	return t
+}
+
+func (p *parser) posOf(t token) Pos {
+	return Pos{p.name, t.line, t.col}
+}
+
+func (p *parser) errorf(t token, format string, args ...any) {
+	panic(&parseError{p.name, t.line, t.col, fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokOp || t.kind == tokIdent) && t.text == text
+}
+
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) token {
+	t := p.next()
+	if (t.kind != tokOp && t.kind != tokIdent) || t.text != text {
+		p.errorf(t, "expected %q but got %v", text, t)
+	}
+	return t
+}
+
+func (p *parser) ident() string {
+	t := p.next()
+	if t.kind != tokIdent {
+		p.errorf(t, "expected identifier but got %v", t)
+	}
+	return t.text
+}
+
+func (p *parser) skipSemis() {
+	for p.peek().kind == tokSemi {
+		p.next()
+	}
+}
+
+func (p *parser) expectSemi() {
+	t := p.peek()
+	switch {
+	case t.kind == tokSemi:
+		p.skipSemis()
+	case t.kind == tokEOF, t.kind == tokOp && (t.text == ")" || t.text == "}"):
+	default:
+		p.errorf(t, "expected newline or ';' but got %v", t)
+	}
+}
+
+func (p *parser) file() *File {
+	f := &File{name: p.name}
+
+	p.skipSemis()
+	p.expect("package")
+	f.pkg = p.ident()
+	p.expectSemi()
+
+	for p.accept("import") {
+		f.imports = append(f.imports, group(p, p.importSpec)...)
+		p.expectSemi()
+	}
+
+	for p.peek().kind != tokEOF {
+		if p.accept("type") {
+			f.types = append(f.types, group(p, p.typeSpec)...)
+		} else if p.accept("const") {
+			f.consts = append(f.consts, p.constDecl()...)
+		} else if fn, ok := p.funcDecl(); ok {
+			f.funcs = append(f.funcs, fn)
+		}
+		p.expectSemi()
+	}
+
+	return f
+}
+
+// group parses either a single spec or a parenthesized list of specs
+func group[T any](p *parser, spec func() T) []T {
+	if !p.accept("(") {
+		return []T{spec()}
+	}
+	res := []T{}
+	p.skipSemis()
+	for !p.accept(")") {
+		res = append(res, spec())
+		p.expectSemi()
+	}
+	return res
+}
+
+func (p *parser) typeSpec() TypeDecl {
+	pos := p.posOf(p.peek())
+	name := p.ident()
+	alias := p.accept("=")
+	return TypeDecl{name, p.typ(), alias, pos}
+}
+
+// constDecl parses a single const spec or a group of them. Within a group,
+// iota is the index of the spec and a spec without a value repeats the type
+// and value of the previous one.
+func (p *parser) constDecl() []ConstDecl {
+	index := 0
+	var prev *ConstDecl
+	return group(p, func() ConstDecl {
+		pos := p.posOf(p.peek())
+		d := ConstDecl{name: p.ident(), pos: pos}
+		if !p.is("=") && p.peek().kind != tokSemi && !p.is(")") {
+			d.typ = p.typ()
+		}
+		switch {
+		case p.accept("="):
+			d.value = p.expr()
+		case prev != nil && d.typ == nil:
+			d.typ, d.value = prev.typ, prev.value
+		default:
+			p.errorf(p.peek(), "missing value in declaration of constant %s", d.name)
+		}
+		prev = &ConstDecl{typ: d.typ, value: d.value}
+
+		iota := index
+		index++
+		d.value = Rewrite(d.value, func(e Expr) Expr {
+			if v, ok := e.(Var); ok && v.Name == "iota" {
+				return IntLit{iota, v.pos}
+			}
+			return e
+		})
+		return d
+	})
+}
+
+func (p *parser) importSpec() Import {
+	imp := Import{pos: p.posOf(p.peek())}
+	if p.peek().kind == tokIdent || p.is(".") {
+		imp.alias = p.next().text
+	}
+	t := p.next()
+	if t.kind != tokString {
+		p.errorf(t, "expected import path but got %v", t)
+	}
+	path, err := strconv.Unquote(t.text)
+	if err != nil {
+		p.errorf(t, "invalid import path %s", t.text)
+	}
+	imp.path = path
+	return imp
+}
+
+// funcDecl parses a function declaration together with its specification.
+// Only pure functions are returned. Methods, other functions and any other
+// declaration, such as a predicate, are skipped with their specification,
+// which may use what the interpreter does not support.
+func (p *parser) funcDecl() (Func, bool) {
+	fn := Func{}
+	pure := false
+	// the clauses are parsed once the function is known to be pure
+	clauses := []int{}
+
+	for !p.is("func") {
+		t := p.peek()
+		switch {
+		case t.kind == tokSemi:
+			p.next()
+		case t.text == "ghost":
+			p.next()
+		case t.text == "pure":
+			p.next()
+			pure = true
+		case t.text == "requires", t.text == "ensures", t.text == "decreases":
+			clauses = append(clauses, p.toks.Index())
+			p.skipDecl()
+		default:
+			p.skipDecl()
+			return fn, false
+		}
+	}
+	if !pure || p.lookahead(2).text == "(" {
+		p.skipDecl()
+		return fn, false
+	}
+
+	start := p.toks.Index()
+	for _, clause := range clauses {
+		p.toks.Seek(clause)
+		switch t := p.next(); t.text {
+		case "requires":
+			fn.requires = append(fn.requires, p.expr())
+		case "ensures":
+			fn.ensures = append(fn.ensures, p.expr())
+		case "decreases":
+			fn.decreases = []Expr{}
+			if p.peek().kind != tokSemi {
+				fn.decreases = p.exprList()
+			}
+		}
+		p.expectSemi()
+	}
+	p.toks.Seek(start)
+	p.expect("func")
+
+	fn.pos = p.posOf(p.peek())
+	fn.Name = p.ident()
+	fn.vars, fn.argtypes = p.params()
+	fn.result, fn.rettyp = p.result()
+
+	if !p.is("{") {
+		return fn, true
+	}
+
+	p.expect("{")
+	p.skipSemis()
+	p.expect("return")
+	fn.body = p.expr()
+	p.skipSemis()
+	p.expect("}")
+
+	return fn, true
+}
+
+func (p *parser) params() ([]string, []Type) {
+	names := []string{}
+	types := []Type{}
+
+	p.expect("(")
+	for !p.accept(")") {
+		group := []string{p.ident()}
+		for p.accept(",") {
+			group = append(group, p.ident())
+		}
+		typ := p.typ()
+		for _, name := range group {
+			names = append(names, name)
+			types = append(types, typ)
+		}
+		if !p.is(")") {
+			p.expect(",")
+		}
+	}
+
+	return names, types
+}
+
+func (p *parser) result() (string, Type) {
+	if p.is("{") || p.peek().kind == tokSemi {
+		return "", nil
+	}
+	if !p.accept("(") {
+		return "", p.typ()
+	}
+
+	name := ""
+	if p.peek().kind == tokIdent && p.isTypeStart(p.lookahead(2)) {
+		name = p.ident()
+	}
+	typ := p.typ()
+	p.expect(")")
+	return name, typ
+}
+
+func (p *parser) isTypeStart(t token) bool {
+	return t.kind == tokIdent || (t.kind == tokOp && t.text == "[")
+}
+
+// skipDecl skips a declaration or a specification clause, up to the next
+// semicolon outside of brackets
+func (p *parser) skipDecl() {
+	depth := 0
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokEOF:
+			if depth > 0 {
+				p.errorf(t, "unexpected end of file in declaration")
+			}
+			return
+		case t.kind == tokSemi && depth == 0:
+			return
+		case t.kind == tokOp && (t.text == "(" || t.text == "[" || t.text == "{"):
+			depth++
+		case t.kind == tokOp && (t.text == ")" || t.text == "]" || t.text == "}"):
+			if depth == 0 {
+				p.errorf(t, "unexpected %v", t)
+			}
+			depth--
+		}
+		p.next()
+	}
+}
+
+func (p *parser) typ() Type {
+	t := p.peek()
+	name := p.ident()
+	switch name {
+	case "int":
+		return tint()
+	case "bool":
+		return tbool()
+	case "byte", "uint8":
+		return tbyte()
+	case "seq":
+		p.expect("[")
+		elem := p.typ()
+		p.expect("]")
+		return TSeq{elem}
+	case "set":
+		p.expect("[")
+		elem := p.typ()
+		p.expect("]")
+		return TSet{elem}
+	case "mset":
+		p.expect("[")
+		elem := p.typ()
+		p.expect("]")
+		return TMset{elem}
+	case "struct":
+		return p.structType()
+	}
+	if p.accept(".") {
+		name = name + "." + p.ident()
+	}
+	if p.is("[") {
+		p.errorf(t, "unsupported type %s", name)
+	}
+	return TAbstract{name}
+}
+
+func (p *parser) structType() TStruct {
+	res := TStruct{}
+	p.expect("{")
+	p.skipSemis()
+	for !p.accept("}") {
+		t := p.peek()
+		names := []string{p.ident()}
+		for p.accept(",") {
+			names = append(names, p.ident())
+		}
+		typ := p.typ()
+		for _, name := range names {
+			if _, ok := res.field(name); ok {
+				p.errorf(t, "duplicate field %s", name)
+			}
+			res.fields = append(res.fields, StructField{name, typ})
+		}
+		p.expectSemi()
+	}
+	return res
+}
+
+func (p *parser) exprList() []Expr {
+	res := []Expr{p.expr()}
+	for p.accept(",") {
+		res = append(res, p.expr())
+	}
+	return res
+}
+
+func (p *parser) expr() Expr {
+	cond := p.implication()
+	if !p.accept("?") {
+		return cond
+	}
+	p.skipSemis()
+	yes := p.expr()
+	p.expect(":")
+	no := p.expr()
+	return Ternop{cond, yes, no, cond.Pos()}
+}
+
+// implication binds weaker than all other binary operators and, unlike them,
+// groups to the right
+func (p *parser) implication() Expr {
+	l := p.binary(0)
+	if !p.accept("==>") {
+		return l
+	}
+	return Binop{implies, l, p.implication(), l.Pos()}
+}
+
+var binopPrec = []map[string]binop{
+	{"||": or},
+	{"&&": and},
+	{"==": eqeq, "!=": neq, "<": lt, "<=": leq, ">": gt, ">=": geq},
+	{"in": in, "subset": subset, "#": multiplicity},
+	{"++": concat, "union": union, "intersection": intersection, "setminus": setminus},
+	{"+": add, "-": sub},
+	{"*": mul, "/": div, "%": mod},
+}
+
+func (p *parser) binary(prec int) Expr {
+	if prec == len(binopPrec) {
+		return p.unary()
+	}
+
+	l := p.binary(prec + 1)
+	for {
+		t := p.peek()
+		op, ok := binopPrec[prec][t.text]
+		if !ok || !p.is(t.text) || op == in && p.inEnds {
+			return l
+		}
+		p.next()
+		l = Binop{op, l, p.binary(prec + 1), l.Pos()}
+	}
+}
+
+var unopTokens = map[string]unop{"!": not, "-": neg}
+
+func (p *parser) unary() Expr {
+	t := p.peek()
+	op, ok := unopTokens[t.text]
+	if t.kind != tokOp || !ok {
+		return p.primary()
+	}
+	p.next()
+	return Unop{op, p.unary(), p.posOf(t)}
+}
+
+func (p *parser) primary() Expr {
+	e := p.operand()
+	for {
+		t := p.peek()
+		switch {
+		case p.accept("."):
+			e = FieldAccess{e, p.ident(), e.Pos()}
+		case p.accept("("):
+			name, ok := calleeName(e)
+			if !ok {
+				p.errorf(t, "cannot call %v", e)
+			}
+			args := []Expr{}
+			for !p.accept(")") {
+				args = append(args, p.nested())
+				if !p.is(")") {
+					p.expect(",")
+				}
+			}
+			e = Call{name: name, args: args, pos: e.Pos()}
+		case p.accept("["):
+			e = p.indexOrSlice(e)
+		default:
+			return e
+		}
+	}
+}
+
+func calleeName(e Expr) (string, bool) {
+	switch e := e.(type) {
+	case Var:
+		return e.Name, true
+	case FieldAccess:
+		pkg, ok := e.lhs.(Var)
+		if ok {
+			return pkg.Name + "." + e.field, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) indexOrSlice(s Expr) Expr {
+	var low, high Expr
+	if !p.is(":") {
+		low = p.nested()
+		if p.accept("]") {
+			return SeqIndex{s, low, s.Pos()}
+		}
+		if p.accept("=") {
+			v := p.nested()
+			p.expect("]")
+			return SeqUpdate{s, low, v, s.Pos()}
+		}
+	}
+	p.expect(":")
+	if !p.is("]") {
+		high = p.nested()
+	}
+	p.expect("]")
+	return SeqSlice{s, low, high, s.Pos()}
+}
+
+func (p *parser) operand() Expr {
+	start := p.toks.Index()
+	t := p.next()
+	pos := p.posOf(t)
+	switch t.kind {
+	case tokInt:
+		v, err := parseIntLit(t)
+		if err != nil {
+			p.errorf(t, "%v", err)
+		}
+		return IntLit{v, pos}
+	case tokChar:
+		v, err := parseCharLit(t)
+		if err != nil {
+			p.errorf(t, "%v", err)
+		}
+		return IntLit{v, pos}
+	case tokOp:
+		if t.text == "(" {
+			p.skipSemis()
+			e := p.nested()
+			p.skipSemis()
+			p.expect(")")
+			return e
+		}
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return BoolLit{true, pos}
+		case "false":
+			return BoolLit{false, pos}
+		case "seq":
+			if p.isRange() {
+				p.expect("[")
+				low := p.nested()
+				p.expect("..")
+				high := p.nested()
+				p.expect("]")
+				return SeqRange{low, high, pos}
+			}
+			p.toks.Seek(start)
+			typ := p.typ().(TSeq)
+			return p.seqLit(typ, pos)
+		case "set", "mset":
+			if !p.is("[") {
+				break
+			}
+			p.toks.Seek(start)
+			typ := p.typ()
+			return SetLit{typ, p.elements(elemOf(typ)), pos}
+		case "let":
+			name := p.ident()
+			p.expect(":=")
+			inEnds := p.inEnds
+			p.inEnds = true
+			value := p.expr()
+			p.inEnds = inEnds
+			p.expect("in")
+			return Let{name, value, p.expr(), pos}
+		}
+		name := t.text
+		if p.is(".") && p.lookahead(2).kind == tokIdent && p.lookahead(3).text == "{" {
+			p.next()
+			name = name + "." + p.ident()
+		}
+		if p.is("{") {
+			return StructLit{name, p.fields(), pos}
+		}
+		return Var{name, pos}
+	}
+	p.errorf(t, "expected expression but got %v", t)
+	return nil
+}
+
+// nested parses an expression enclosed in brackets, where in is always a
+// membership test
+func (p *parser) nested() Expr {
+	inEnds := p.inEnds
+	p.inEnds = false
+	defer func() { p.inEnds = inEnds }()
+	return p.expr()
+}
+
+// isRange reports whether the brackets after seq enclose a range lo..hi
+// rather than an element type
+func (p *parser) isRange() bool {
+	if !p.is("[") {
+		return false
+	}
+	depth := 0
+	for k := 1; ; k++ {
+		t := p.lookahead(k)
+		if t.kind == tokEOF {
+			return false
+		}
+		if t.kind != tokOp {
+			continue
+		}
+		switch t.text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+			if depth == 0 {
+				return false
+			}
+		case "..":
+			if depth == 1 {
+				return true
+			}
+		}
+	}
+}
+
+// elemOf returns the element type of a set or multiset type
+func elemOf(t Type) Type {
+	switch t := t.(type) {
+	case TSet:
+		return t.elem
+	case TMset:
+		return t.elem
+	}
+	return nil
+}
+
+// elements parses the positional elements of a composite literal
+func (p *parser) elements(elem Type) []Expr {
+	p.expect("{")
+	p.skipSemis()
+	res := []Expr{}
+	for !p.accept("}") {
+		res = append(res, p.element(elem))
+		if !p.is("}") {
+			p.expect(",")
+		}
+		p.skipSemis()
+	}
+	return res
+}
+
+// seqLit parses the elements of a sequence literal of type typ, which are
+// either all positional or given with their indices
+func (p *parser) seqLit(typ TSeq, pos Pos) Expr {
+	p.expect("{")
+	p.skipSemis()
+	keys, args := []Expr{}, []Expr{}
+	keyed := false
+	for !p.accept("}") {
+		var key Expr
+		arg := p.element(typ.elem)
+		if p.accept(":") {
+			key, arg = arg, p.element(typ.elem)
+			keyed = true
+		}
+		keys, args = append(keys, key), append(args, arg)
+		if !p.is("}") {
+			p.expect(",")
+		}
+		p.skipSemis()
+	}
+	if keyed {
+		return KeyedSeqLit{typ, keys, args, pos}
+	}
+	return SeqLit{typ, args, pos}
+}
+
+// element parses an element of a composite literal, whose type may be elided
+// if it is itself a composite literal
+func (p *parser) element(typ Type) Expr {
+	if !p.is("{") {
+		return p.nested()
+	}
+	pos := p.posOf(p.peek())
+	switch typ := typ.(type) {
+	case TSeq:
+		return p.seqLit(typ, pos)
+	case TSet, TMset:
+		return SetLit{typ, p.elements(elemOf(typ)), pos}
+	case TAbstract, nil:
+		return p.elidedLit(typ, pos)
+	}
+	p.errorf(p.peek(), "cannot elide type %v in composite literal", typ)
+	return nil
+}
+
+// elidedLit parses a composite literal whose type is the name typ, or unknown
+// if nil. Whether it is a sequence, set or struct literal is decided once the
+// types are resolved; only the keys of a struct literal are names.
+func (p *parser) elidedLit(typ Type, pos Pos) Expr {
+	k := 2
+	for p.lookahead(k).kind == tokSemi {
+		k++
+	}
+	if p.lookahead(k).kind == tokIdent && p.lookahead(k+1).text == ":" {
+		return ElidedLit{typ: typ, fields: p.fields(), pos: pos}
+	}
+
+	p.expect("{")
+	p.skipSemis()
+	keys, args := []Expr{}, []Expr{}
+	for !p.accept("}") {
+		var key Expr
+		arg := p.element(nil)
+		if p.accept(":") {
+			key, arg = arg, p.element(nil)
+		}
+		keys, args = append(keys, key), append(args, arg)
+		if !p.is("}") {
+			p.expect(",")
+		}
+		p.skipSemis()
+	}
+	return ElidedLit{typ, keys, args, nil, pos}
+}
+
+func (p *parser) fields() map[string]Expr {
+	p.expect("{")
+	p.skipSemis()
+	res := make(map[string]Expr)
+	for !p.accept("}") {
+		t := p.peek()
+		name := p.ident()
+		if _, ok := res[name]; ok {
+			p.errorf(t, "duplicate field %s", name)
+		}
+		p.expect(":")
+		res[name] = p.nested()
+		if !p.is("}") {
+			p.expect(",")
+		}
+		p.skipSemis()
+	}
+	return res
+}
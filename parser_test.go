@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/antlr4-go/antlr/v4"
+)
+
+const mixedSrc = `package main
+
+type T struct {
+	x int
+}
+
+pred P(t *T) {
+	acc(&t.x) && t.x > 0
+}
+
+requires acc(&t.x)
+ensures res == t.x
+func (t *T) Get() (res int) {
+	return t.x
+}
+
+ghost
+requires forall i int :: 0 <= i && i < len(s) ==>
+	s[i] > 0
+decreases
+func Lemma(s seq[int]) {
+	x := ` + "`raw`" + `
+	for i := 0; i < len(s); i++ {
+		x += "a"
+	}
+}
+
+ghost
+requires n >= 0
+ensures res == n + n
+decreases n
+pure func double(n int) (res int) {
+	return n + n
+}
+`
+
+func TestParseSkipsUnsupportedDecls(t *testing.T) {
+	f, err := parseFile(antlr.NewInputStream(mixedSrc), "mixed.gobra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.types) != 1 || f.types[0].name != "T" {
+		t.Errorf("got types %v, want T", f.types)
+	}
+	if len(f.funcs) != 1 {
+		t.Fatalf("got %d functions, want double only", len(f.funcs))
+	}
+	fn := f.funcs[0]
+	if fn.Name != "double" || len(fn.requires) != 1 || len(fn.ensures) != 1 || len(fn.decreases) != 1 {
+		t.Errorf("got %s with %d requires, %d ensures and %d decreases clauses, want double with one of each",
+			fn.Name, len(fn.requires), len(fn.ensures), len(fn.decreases))
+	}
+	if got, want := fn.body.String(), "(n + n)"; got != want {
+		t.Errorf("got body %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import "fmt"
+
+// Pos is the location of an expression in its source file. The zero value
+// marks expressions that were constructed by the interpreter itself.
+type Pos struct {
+	file string
+	line int
+	col  int
+}
+
+func (p Pos) IsValid() bool {
+	return p.line > 0
+}
+
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%s:%d:%d", p.file, p.line, p.col)
+}
+
+// posf formats a message and prefixes it with pos if it is known
+func posf(pos Pos, format string, args ...any) string {
+	msg := fmt.Sprintf(format, args...)
+	if !pos.IsValid() {
+		return msg
+	}
+	return fmt.Sprintf("%v: %s", pos, msg)
+}
+
+func (e Binop) Pos() Pos       { return e.pos }
+func (e Unop) Pos() Pos        { return e.pos }
+func (e Ternop) Pos() Pos      { return e.pos }
+func (e Let) Pos() Pos         { return e.pos }
+func (e Call) Pos() Pos        { return e.pos }
+func (e SeqLit) Pos() Pos      { return e.pos }
+func (e SetLit) Pos() Pos      { return e.pos }
+func (e StructLit) Pos() Pos   { return e.pos }
+func (e SeqSlice) Pos() Pos    { return e.pos }
+func (e SeqIndex) Pos() Pos    { return e.pos }
+func (e SeqRange) Pos() Pos    { return e.pos }
+func (e SeqUpdate) Pos() Pos   { return e.pos }
+func (e KeyedSeqLit) Pos() Pos { return e.pos }
+func (e ElidedLit) Pos() Pos   { return e.pos }
+func (e IntLit) Pos() Pos      { return e.pos }
+func (e BoolLit) Pos() Pos     { return e.pos }
+func (e SymLit) Pos() Pos      { return e.pos }
+func (e Var) Pos() Pos         { return e.pos }
+func (e FieldAccess) Pos() Pos { return e.pos }
+func (e Const) Pos() Pos       { return e.pos }
+
+// withPos returns e located at pos
+func withPos(e Expr, pos Pos) Expr {
+	switch e := e.(type) {
+	case Binop:
+		e.pos = pos
+		return e
+	case Unop:
+		e.pos = pos
+		return e
+	case Ternop:
+		e.pos = pos
+		return e
+	case Let:
+		e.pos = pos
+		return e
+	case Call:
+		e.pos = pos
+		return e
+	case SeqLit:
+		e.pos = pos
+		return e
+	case SetLit:
+		e.pos = pos
+		return e
+	case StructLit:
+		e.pos = pos
+		return e
+	case SeqSlice:
+		e.pos = pos
+		return e
+	case SeqIndex:
+		e.pos = pos
+		return e
+	case SeqRange:
+		e.pos = pos
+		return e
+	case SeqUpdate:
+		e.pos = pos
+		return e
+	case KeyedSeqLit:
+		e.pos = pos
+		return e
+	case ElidedLit:
+		e.pos = pos
+		return e
+	case IntLit:
+		e.pos = pos
+		return e
+	case BoolLit:
+		e.pos = pos
+		return e
+	case SymLit:
+		e.pos = pos
+		return e
+	case Var:
+		e.pos = pos
+		return e
+	case FieldAccess:
+		e.pos = pos
+		return e
+	case Const:
+		e.pos = pos
+		return e
+	}
+	panic(fmt.Sprintf("unhandled expression %T", e))
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	gotoken "go/token"
+	"io"
+	"slices"
+	"strings"
+)
+
+const replHelp = `expr               print the value of expr
+ghost x := expr    bind the value of expr to x for the following lines
+:trace expr        print the reduction steps of expr
+:assert expr       print an assertion for every call and slice made by expr
+:fns               list the loaded functions
+:load path...      load more files or directories
+:reload            load all files again
+:help              print this help
+:quit              exit the REPL
+`
+
+// binding is a ghost variable defined at the prompt
+type binding struct {
+	name  string
+	value Expr
+}
+
+type repl struct {
+	loader   Loader
+	sources  []string
+	opts     options
+	c        Ctx
+	bindings []binding
+	out      io.Writer
+}
+
+func newREPL(l Loader, sources []string, opts options) *repl {
+	return &repl{loader: l, sources: sources, opts: opts}
+}
+
+// load replaces the context by the one of sources. The previous context stays
+// in place if loading fails.
+func (r *repl) load(sources []string) error {
+	c, err := r.loader.loadSources(sources)
+	if err != nil {
+		return err
+	}
+	r.c, r.sources = c, sources
+	return nil
+}
+
+// run reads lines from in until it ends or :quit is entered and returns the
+// exit code
+func (r *repl) run(in io.Reader, out io.Writer) int {
+	r.out = out
+	if err := r.load(r.sources); err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !sc.Scan() {
+			fmt.Fprintln(out)
+			return 0
+		}
+		line := strings.TrimSpace(sc.Text())
+		if line == ":quit" || line == ":q" {
+			return 0
+		}
+		if err := r.line(line); err != nil {
+			fmt.Fprintln(out, err)
+		}
+	}
+}
+
+// line executes a single line entered at the prompt
+func (r *repl) line(line string) error {
+	if line == "" {
+		return nil
+	}
+	if !strings.HasPrefix(line, ":") {
+		if name, src, ok := parseBinding(line); ok {
+			return r.bind(name, src)
+		}
+		return r.exec(findCommand("eval"), line)
+	}
+
+	name, arg, _ := strings.Cut(line[1:], " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "help":
+		fmt.Fprint(r.out, replHelp)
+	case "trace", "assert":
+		return r.exec(findCommand(name), arg)
+	case "fns":
+		fns := slices.Clone(r.c.fns)
+		slices.SortFunc(fns, func(a, b Func) int { return strings.Compare(a.Name, b.Name) })
+		for _, fn := range fns {
+			fmt.Fprintln(r.out, fn.Signature())
+		}
+	case "load":
+		if arg == "" {
+			return fmt.Errorf("usage: :load path...")
+		}
+		return r.load(append(slices.Clip(r.sources), strings.Fields(arg)...))
+	case "reload":
+		return r.load(r.sources)
+	default:
+		return fmt.Errorf("unknown command :%s, see :help", name)
+	}
+	return nil
+}
+
+// parseBinding splits a line of the form [ghost] name := expr
+func parseBinding(line string) (string, string, bool) {
+	lhs, src, ok := strings.Cut(line, ":=")
+	if !ok {
+		return "", "", false
+	}
+	name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lhs), "ghost "))
+	if !gotoken.IsIdentifier(name) {
+		return "", "", false
+	}
+	return name, src, true
+}
+
+// input parses src and replaces the variables bound at the prompt
+func (r *repl) input(src string) (Expr, error) {
+	e, err := parseExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range slices.Backward(r.bindings) {
+		e = e.Subst(b.name, b.value)
+	}
+	return r.c.resolveInput(e), nil
+}
+
+// bind evaluates src and binds its value to name, replacing an earlier
+// binding of the same name
+func (r *repl) bind(name, src string) error {
+	e, err := r.input(src)
+	if err != nil {
+		return err
+	}
+	res, err := runExpr(findCommand("eval"), r.c, e, r.opts)
+	if err != nil {
+		return err
+	}
+	r.bindings = slices.DeleteFunc(r.bindings, func(b binding) bool { return b.name == name })
+	r.bindings = append(r.bindings, binding{name, res.value})
+	fmt.Fprintf(r.out, "%s = %v\n", name, res.value)
+	return nil
+}
+
+func (r *repl) exec(cmd *command, src string) error {
+	e, err := r.input(src)
+	if err != nil {
+		return err
+	}
+	res, err := runExpr(cmd, r.c, e, r.opts)
+	if err != nil {
+		return err
+	}
+
+	if res.asserts == nil {
+		fmt.Fprintln(r.out, res.value)
+		return nil
+	}
+
+	opts := r.opts
+	opts.abbrevs = make([]Abbrev, len(r.opts.abbrevs))
+	for i, a := range r.opts.abbrevs {
+		opts.abbrevs[i] = Abbrev{a.name, r.c.resolveInput(a.expr)}
+	}
+	writeText(r.out, res, opts)
+	return nil
+}
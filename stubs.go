@@ -0,0 +1,54 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+	"slices"
+
+	"github.com/antlr4-go/antlr/v4"
+)
+
+// stubs holds the specifications of commonly used packages, one directory
+// per import path
+//
+//go:embed stubs
+var stubs embed.FS
+
+// stubFiles parses the bundled stubs below dir. An unknown import path
+// yields no files.
+func stubFiles(dir string) ([]*File, error) {
+	root := path.Join("stubs", dir)
+	if _, err := fs.Stat(stubs, root); err != nil {
+		return nil, nil
+	}
+
+	names := []string{}
+	err := fs.WalkDir(stubs, root, func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && path.Ext(name) == ".gobra" {
+			// only the package itself, not the packages nested below it
+			if dir == "." || path.Dir(name) == root {
+				names = append(names, name)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+
+	files := []*File{}
+	for _, name := range names {
+		src, err := stubs.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parseFile(antlr.NewInputStream(string(src)), name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
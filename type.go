@@ -1,6 +1,11 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
 
 type Type interface {
 	String() string
@@ -58,6 +63,57 @@ func (t TSeq) String() string {
 	return fmt.Sprintf("seq[%s]", t.elem.String())
 }
 
+type TSet struct {
+	elem Type
+}
+
+func (t TSet) String() string {
+	return fmt.Sprintf("set[%s]", t.elem.String())
+}
+
+type TMset struct {
+	elem Type
+}
+
+func (t TMset) String() string {
+	return fmt.Sprintf("mset[%s]", t.elem.String())
+}
+
+type StructField struct {
+	name string
+	typ  Type
+}
+
+type TStruct struct {
+	fields []StructField
+}
+
+func (t TStruct) String() string {
+	fields := make([]string, len(t.fields))
+	for i, f := range t.fields {
+		fields[i] = fmt.Sprintf("%s %s", f.name, f.typ)
+	}
+	return fmt.Sprintf("struct{%s}", strings.Join(fields, "; "))
+}
+
+func (t TStruct) field(name string) (Type, bool) {
+	for _, f := range t.fields {
+		if f.name == name {
+			return f.typ, true
+		}
+	}
+	return nil, false
+}
+
+type TypeDecl struct {
+	name string
+	typ  Type
+	// aliases (type X = T) denote the same type as T, while defined types
+	// (type X T) are distinct from T
+	alias bool
+	pos   Pos
+}
+
 func isAbstract(t Type) bool {
 	_, ok := t.(TAbstract)
 	return ok
@@ -72,39 +128,81 @@ func expectSeq(t Type) TSeq {
 }
 
 var binopMatch = []primitiveKind{
-	eqeq: boolKind,
-	add:  intKind,
-	mul:  intKind,
-	sub:  intKind,
-	div:  intKind,
-	gt:   boolKind,
-	lt:   boolKind,
-	and:  boolKind,
+	eqeq:         boolKind,
+	add:          intKind,
+	mul:          intKind,
+	sub:          intKind,
+	div:          intKind,
+	gt:           boolKind,
+	lt:           boolKind,
+	and:          boolKind,
+	or:           boolKind,
+	neq:          boolKind,
+	leq:          boolKind,
+	geq:          boolKind,
+	mod:          intKind,
+	implies:      boolKind,
+	in:           boolKind,
+	subset:       boolKind,
+	multiplicity: intKind,
 }
 
 func (t Binop) Type(c *Ctx) Type {
-	if t.opcode == concat {
+	switch t.opcode {
+	case concat, union, intersection, setminus:
 		return t.l.Type(c)
 	}
 
 	return TPrim{binopMatch[t.opcode]}
 }
 
+func (t Unop) Type(c *Ctx) Type {
+	if t.opcode == not {
+		return tbool()
+	}
+	return tint()
+}
+
+func (t SeqUpdate) Type(c *Ctx) Type   { return t.s.Type(c) }
+func (t SeqRange) Type(c *Ctx) Type    { return TSeq{tint()} }
+func (t KeyedSeqLit) Type(c *Ctx) Type { return t.typ }
+func (t SetLit) Type(c *Ctx) Type      { return t.typ }
+func (t ElidedLit) Type(c *Ctx) Type   { return t.typ }
+
 func (t SeqIndex) Type(c *Ctx) Type {
-	fmt.Printf("t.s: %#v\n", t.s)
-	if isAbstract(t.s.Type(c)) {
+	typ, ok := c.underlying(t.s.Type(c)).(TSeq)
+	if !ok {
 		return nil
 	}
-	return expectSeq(t.s.Type(c)).elem
+	return typ.elem
 }
 func (t SeqSlice) Type(c *Ctx) Type  { return t.s.Type(c) }
 func (t BoolLit) Type(c *Ctx) Type   { return tbool() }
 func (t IntLit) Type(c *Ctx) Type    { return tint() }
 func (t Ternop) Type(c *Ctx) Type    { return t.yes.Type(c) }
+func (t Let) Type(c *Ctx) Type       { return t.body.Type(c) }
 func (t Var) Type(c *Ctx) Type       { return TAbstract{t.Name} }
 func (t StructLit) Type(c *Ctx) Type { return TAbstract{t.typ} }
 func (t SymLit) Type(c *Ctx) Type    { return t.val.e.Type(c) }
+func (t Const) Type(c *Ctx) Type {
+	d, ok := c.consts[t.name]
+	if !ok {
+		return nil
+	}
+	if d.typ != nil {
+		return d.typ
+	}
+	return d.value.Type(c)
+}
 func (t Call) Type(c *Ctx) Type {
+	switch t.name {
+	case "len":
+		return tint()
+	case "set":
+		return TSet{c.elemType(t.args[0].Type(c))}
+	case "mset":
+		return TMset{c.elemType(t.args[0].Type(c))}
+	}
 	fn := c.tryGetFn(t.name)
 	if fn == nil {
 		return nil
@@ -120,11 +218,315 @@ func (t SeqLit) Type(c *Ctx) Type {
 	for _, el := range t.args {
 		ty := el.Type(c)
 		if ty != nil {
-			return TSeq{ty}
+			return c.resolveType(TSeq{ty})
 		}
 	}
 	return nil
 }
 func (t FieldAccess) Type(c *Ctx) Type {
-	return TAbstract{"unknown"}
+	st, ok := c.structType(t.lhs.Type(c))
+	if !ok {
+		return nil
+	}
+	typ, _ := st.field(t.field)
+	return typ
+}
+
+// structType returns the declared struct type behind t
+func (c *Ctx) structType(t Type) (TStruct, bool) {
+	st, ok := c.underlying(t).(TStruct)
+	return st, ok
+}
+
+// zeroValue returns the default value of type t
+func (c *Ctx) zeroValue(t Type) Val {
+	switch u := c.underlying(t).(type) {
+	case TPrim:
+		if u.kind == boolKind {
+			return Bool{false}
+		}
+		return Int{0}
+	case TSeq:
+		return Seq{t, []Val{}}
+	case TSet:
+		return Set{t, []Val{}}
+	case TMset:
+		return Mset{t, []Val{}}
+	case TStruct:
+		fields := map[string]Val{}
+		for _, f := range u.fields {
+			fields[f.name] = c.zeroValue(f.typ)
+		}
+		name, _ := t.(TAbstract)
+		return Struct{name.name, fields}
+	}
+	panic(fmt.Sprintf("no default value of type %v", t))
+}
+
+// resolveType replaces all aliases in t by the types they stand for
+func (c *Ctx) resolveType(t Type) Type {
+	switch t := t.(type) {
+	case TAbstract:
+		if d, ok := c.types[t.name]; ok && d.alias {
+			return c.resolveType(d.typ)
+		}
+	case TSeq:
+		return TSeq{c.resolveType(t.elem)}
+	case TSet:
+		return TSet{c.resolveType(t.elem)}
+	case TMset:
+		return TMset{c.resolveType(t.elem)}
+	case TStruct:
+		fields := make([]StructField, len(t.fields))
+		for i, f := range t.fields {
+			fields[i] = StructField{f.name, c.resolveType(f.typ)}
+		}
+		return TStruct{fields}
+	}
+	return t
+}
+
+// elemType returns the element type of the sequence type t, nil if t is not
+// known to be one
+func (c *Ctx) elemType(t Type) Type {
+	if s, ok := c.underlying(t).(TSeq); ok {
+		return s.elem
+	}
+	return nil
+}
+
+// underlying returns the type a named type is defined as
+func (c *Ctx) underlying(t Type) Type {
+	for {
+		named, ok := t.(TAbstract)
+		if !ok {
+			return t
+		}
+		d, ok := c.types[named.name]
+		if !ok {
+			return t
+		}
+		t = d.typ
+	}
+}
+
+// resolveExpr replaces the aliases used in the literals of e
+func (c *Ctx) resolveExpr(e Expr) Expr {
+	return Rewrite(e, func(e Expr) Expr {
+		switch e := e.(type) {
+		case SeqLit:
+			if e.typ != nil {
+				e.typ = c.resolveType(e.typ)
+			}
+			return e
+		case KeyedSeqLit:
+			e.typ = c.resolveType(e.typ).(TSeq)
+			return e
+		case SetLit:
+			e.typ = c.resolveType(e.typ)
+			return e
+		case StructLit:
+			if named, ok := c.resolveType(TAbstract{e.typ}).(TAbstract); ok {
+				e.typ = named.name
+			}
+			return c.withZeroFields(e)
+		case ElidedLit:
+			if e.typ != nil {
+				return c.typedLit(e, e.typ)
+			}
+			return e
+		}
+		return e
+	})
+}
+
+// typedLit replaces the composite literal e by a literal of type typ, and so
+// do the elements of e whose type is elided. It returns e typed as typ if e
+// cannot be a literal of that type.
+func (c *Ctx) typedLit(e ElidedLit, typ Type) Expr {
+	typ = c.resolveType(typ)
+	typed := func(elem Type, es []Expr) []Expr {
+		res := make([]Expr, len(es))
+		for i, e := range es {
+			if inner, ok := e.(ElidedLit); ok && inner.typ == nil {
+				e = c.typedLit(inner, elem)
+			}
+			res[i] = e
+		}
+		return res
+	}
+	keyed := slices.ContainsFunc(e.keys, func(k Expr) bool { return k != nil })
+
+	switch u := c.underlying(typ).(type) {
+	case TSeq:
+		if e.fields != nil {
+			break
+		}
+		if keyed {
+			return KeyedSeqLit{u, e.keys, typed(u.elem, e.args), e.pos}
+		}
+		return SeqLit{u, typed(u.elem, e.args), e.pos}
+	case TSet, TMset:
+		if e.fields != nil || keyed {
+			break
+		}
+		return SetLit{u, typed(elemOf(u), e.args), e.pos}
+	case TStruct:
+		named, ok := typ.(TAbstract)
+		if !ok || len(e.args) > 0 {
+			break
+		}
+		fields := make(map[string]Expr)
+		for k, v := range e.fields {
+			if ft, ok := u.field(k); ok {
+				v = typed(ft, []Expr{v})[0]
+			}
+			fields[k] = v
+		}
+		return c.withZeroFields(StructLit{named.name, fields, e.pos})
+	}
+	e.typ = typ
+	return e
+}
+
+// withZeroFields adds the declared fields left out of a struct literal, set to
+// their zero values
+func (c *Ctx) withZeroFields(e StructLit) StructLit {
+	st, ok := c.structType(TAbstract{e.typ})
+	if !ok {
+		return e
+	}
+	fields := maps.Clone(e.fields)
+	for _, f := range st.fields {
+		if _, ok := fields[f.name]; !ok {
+			fields[f.name] = lit(c.zeroValue(f.typ))
+		}
+	}
+	e.fields = fields
+	return e
+}
+
+func (c *Ctx) resolveExprs(es []Expr) []Expr {
+	if es == nil {
+		return nil
+	}
+	res := make([]Expr, len(es))
+	for i, e := range es {
+		res[i] = c.resolveExpr(e)
+	}
+	return res
+}
+
+// resolveFunc replaces the aliases used in the signature and body of f
+func (c *Ctx) resolveFunc(f Func) Func {
+	argtypes := make([]Type, len(f.argtypes))
+	for i, t := range f.argtypes {
+		argtypes[i] = c.resolveType(t)
+	}
+	f.argtypes = argtypes
+	if f.rettyp != nil {
+		f.rettyp = c.resolveType(f.rettyp)
+	}
+	f.body = c.resolveExpr(f.body)
+	f.requires = c.resolveExprs(f.requires)
+	f.ensures = c.resolveExprs(f.ensures)
+	f.decreases = c.resolveExprs(f.decreases)
+	return f
+}
+
+// isKnown reports whether t carries enough information to be compared with
+// other types. Variables are typed by their name, so abstract types that are
+// not declared are treated as unknown.
+func (c *Ctx) isKnown(t Type) bool {
+	switch t := t.(type) {
+	case nil:
+		return false
+	case TAbstract:
+		_, ok := c.types[t.name]
+		return ok
+	case TSeq:
+		return c.isKnown(t.elem)
+	case TSet:
+		return c.isKnown(t.elem)
+	case TMset:
+		return c.isKnown(t.elem)
+	}
+	return true
+}
+
+// assignable reports whether a value of type from can be used where a value
+// of type to is expected. Unknown types are assignable to anything.
+//
+// As in Go, two distinct named types are never assignable, while a named and
+// an unnamed type are if their underlying types are.
+func (c *Ctx) assignable(from, to Type) bool {
+	if !c.isKnown(from) || !c.isKnown(to) {
+		return true
+	}
+
+	from, to = c.resolveType(from), c.resolveType(to)
+	if from.String() == to.String() {
+		return true
+	}
+	if isAbstract(from) && isAbstract(to) {
+		return false
+	}
+	from, to = c.underlying(from), c.underlying(to)
+
+	switch to := to.(type) {
+	case TPrim:
+		from, ok := from.(TPrim)
+		if !ok {
+			return false
+		}
+		// bytes are represented as integers
+		numeric := func(k primitiveKind) bool { return k == intKind || k == byteKind }
+		return from.kind == to.kind || numeric(from.kind) && numeric(to.kind)
+	case TSeq:
+		from, ok := from.(TSeq)
+		return ok && c.assignable(from.elem, to.elem)
+	case TSet:
+		from, ok := from.(TSet)
+		return ok && c.assignable(from.elem, to.elem)
+	case TMset:
+		from, ok := from.(TMset)
+		return ok && c.assignable(from.elem, to.elem)
+	}
+
+	return from.String() == to.String()
+}
+
+func valType(v Val) Type {
+	switch v := v.(type) {
+	case Int:
+		return tint()
+	case Bool:
+		return tbool()
+	case Seq:
+		return v.typ
+	case Set:
+		return v.typ
+	case Mset:
+		return v.typ
+	case Struct:
+		return TAbstract{v.typ}
+	}
+	return nil
+}
+
+// checkStruct checks a struct value against the declaration of its type
+func (c *Ctx) checkStruct(s Struct, pos Pos) {
+	st, ok := c.structType(TAbstract{s.typ})
+	if !ok {
+		return
+	}
+	for name, v := range s.fields {
+		typ, ok := st.field(name)
+		if !ok {
+			panic(posf(pos, "struct %q does not have field %q", s.typ, name))
+		}
+		if !c.assignable(valType(v), typ) {
+			panic(posf(pos, "field %q of struct %q has type %v but got %v", name, s.typ, typ, lit(v)))
+		}
+	}
 }
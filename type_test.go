@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/antlr4-go/antlr/v4"
+)
+
+const elidedSrc = `package main
+
+type Segment = seq[byte]
+type Bag = mset[int]
+type Pt struct {
+	x int
+	y int
+}
+
+ghost
+decreases
+pure func segs() seq[Segment] {
+	return seq[Segment]{{'a'}, {}, {1: 'c'}}
+}
+
+ghost
+decreases
+pure func bags() seq[Bag] {
+	return seq[Bag]{{1, 1}}
+}
+
+ghost
+decreases
+pure func pts() seq[Pt] {
+	return seq[Pt]{{x: 1}, {}}
+}
+`
+
+func TestElidedLitTypes(t *testing.T) {
+	f, err := parseFile(antlr.NewInputStream(elidedSrc), "elided.gobra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Loader{}.build([]*File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"segs() == seq[seq[byte]]{seq[byte]{'a'}, seq[byte]{}, seq[byte]{0, 'c'}}", "true"},
+		{"bags()", "seq[mset[int]]{mset[int]{1, 1}}"},
+		{"pts()", "seq[Pt]{Pt{x:1,y:0,}, Pt{x:0,y:0,}}"},
+	}
+	for _, tt := range tests {
+		e, err := parseExpr(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := lit(evaluatesTo(c.resolveInput(e), c)).String(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
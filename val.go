@@ -1,6 +1,12 @@
 package main
 
-import "fmt"
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
 
 type Val interface {
 	Equals(Val) bool
@@ -30,6 +36,104 @@ func (s Seq) Equals(other Val) bool {
 	return true
 }
 
+// Set is a mathematical set. Its elements are kept sorted by compareVals and
+// free of duplicates, so that it prints the same however it was built.
+type Set struct {
+	typ   Type
+	elems []Val
+}
+
+func newSet(typ Type, elems []Val) Set {
+	elems = slices.SortedFunc(slices.Values(elems), compareVals)
+	return Set{typ, slices.CompactFunc(elems, Val.Equals)}
+}
+
+func (s Set) contains(v Val) bool {
+	return slices.ContainsFunc(s.elems, v.Equals)
+}
+
+// Equals ignores the order of the elements
+func (s Set) Equals(other Val) bool {
+	o, ok := other.(Set)
+	if !ok || len(o.elems) != len(s.elems) {
+		return false
+	}
+	for _, v := range s.elems {
+		if !o.contains(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Mset is a multiset. Its elements are kept sorted by compareVals, with each
+// element repeated as often as it occurs.
+type Mset struct {
+	typ   Type
+	elems []Val
+}
+
+func newMset(typ Type, elems []Val) Mset {
+	return Mset{typ, slices.SortedFunc(slices.Values(elems), compareVals)}
+}
+
+// count returns the multiplicity of v
+func (m Mset) count(v Val) int {
+	n := 0
+	for _, e := range m.elems {
+		if e.Equals(v) {
+			n++
+		}
+	}
+	return n
+}
+
+func (m Mset) distinct() []Val {
+	return slices.CompactFunc(slices.Clone(m.elems), Val.Equals)
+}
+
+// union adds the multiplicities of both multisets
+func (m Mset) union(o Mset) Mset {
+	return newMset(m.typ, append(slices.Clone(m.elems), o.elems...))
+}
+
+// intersection keeps the smaller multiplicity of every element
+func (m Mset) intersection(o Mset) Mset {
+	res := []Val{}
+	for _, v := range m.distinct() {
+		for range min(m.count(v), o.count(v)) {
+			res = append(res, v)
+		}
+	}
+	return newMset(m.typ, res)
+}
+
+// setminus subtracts the multiplicities of o, down to zero
+func (m Mset) setminus(o Mset) Mset {
+	res := []Val{}
+	for _, v := range m.distinct() {
+		for range max(m.count(v)-o.count(v), 0) {
+			res = append(res, v)
+		}
+	}
+	return newMset(m.typ, res)
+}
+
+func (m Mset) subset(o Mset) bool {
+	for _, v := range m.distinct() {
+		if m.count(v) > o.count(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equals compares the multiplicities of the elements, ignoring their order
+func (m Mset) Equals(other Val) bool {
+	o, ok := other.(Mset)
+	return ok && len(o.elems) == len(m.elems) && m.subset(o)
+}
+
 type Int struct {
 	val int
 }
@@ -49,7 +153,8 @@ type SymVal struct {
 
 func (s SymVal) Equals(other Val) bool {
 	x, ok := other.(SymVal)
-	return ok && (x == s)
+	// compare the printed expressions so that source positions are ignored
+	return ok && x.e.String() == s.e.String()
 }
 
 type Bool struct {
@@ -96,6 +201,98 @@ func asSeq(v Val) Seq {
 	return val
 }
 
+func asSet(v Val) Set {
+	val, ok := v.(Set)
+	if !ok {
+		panic(fmt.Sprintf("expected type of %v to be set but got something else", v))
+	}
+	return val
+}
+
+// length returns the number of elements of a sequence, set or multiset. The
+// elements of a multiset are counted with their multiplicity.
+func length(v Val) int {
+	switch v := v.(type) {
+	case Seq:
+		return len(v.elems)
+	case Set:
+		return len(v.elems)
+	case Mset:
+		return len(v.elems)
+	}
+	panic(fmt.Sprintf("expected type of %v to have a length but got something else", v))
+}
+
+// compareVals is a total order on values, which orders the elements of sets
+func compareVals(a, b Val) int {
+	if c := cmp.Compare(valRank(a), valRank(b)); c != 0 {
+		return c
+	}
+	switch a := a.(type) {
+	case Int:
+		return cmp.Compare(a.val, b.(Int).val)
+	case Bool:
+		return compareBools(a.val, b.(Bool).val)
+	case Seq:
+		return slices.CompareFunc(a.elems, b.(Seq).elems, compareVals)
+	case Set:
+		return slices.CompareFunc(a.elems, b.(Set).elems, compareVals)
+	case Mset:
+		return slices.CompareFunc(a.elems, b.(Mset).elems, compareVals)
+	case Struct:
+		o := b.(Struct)
+		if c := strings.Compare(a.typ, o.typ); c != 0 {
+			return c
+		}
+		for _, k := range slices.Sorted(maps.Keys(a.fields)) {
+			if c := compareVals(a.fields[k], o.fields[k]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	case SymVal:
+		return strings.Compare(a.e.String(), b.(SymVal).e.String())
+	}
+	panic(fmt.Sprintf("cannot compare %v", a))
+}
+
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+// valRank orders the kinds of values, putting symbolic ones last
+func valRank(v Val) int {
+	switch v.(type) {
+	case Bool:
+		return 0
+	case Int:
+		return 1
+	case Seq:
+		return 2
+	case Set:
+		return 3
+	case Mset:
+		return 4
+	case Struct:
+		return 5
+	}
+	return 6
+}
+
+func asMset(v Val) Mset {
+	val, ok := v.(Mset)
+	if !ok {
+		panic(fmt.Sprintf("expected type of %v to be mset but got something else", v))
+	}
+	return val
+}
+
 func asInt(v Val) int {
 	val, ok := v.(Int)
 	if !ok {